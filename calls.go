@@ -1,13 +1,11 @@
 package main
 
 import (
-	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"log"
 	"math/big"
 	"strconv"
-	"time"
+	"strings"
 
 	"github.com/deroproject/derohe/globals"
 	"github.com/deroproject/derohe/walletapi/mnemonics"
@@ -19,21 +17,13 @@ var new_topoheight_callback = func(value any) {
 	log.Println(height)
 }
 
+// load SC data of the selected contract
 func SC_Request(height uint64) error {
 
-	req := RPC_Request(DAEMON_GET_SC, SC_Build_GetSC_Request(height))
-	data, err := json.Marshal(req)
+	r, err := SC_GetSnapshotAtHeight(sc_active, height)
 	if err != nil {
 		return err
 	}
-	if !xswd.xswd_send(data) {
-		return fmt.Errorf("error sending request")
-	}
-
-	var r GetSC_Result
-	if err = xswd_response(<-xswd.response, &r); err != nil {
-		return err
-	}
 
 	if err = Parse_SC(r); err != nil {
 		return err
@@ -42,167 +32,217 @@ func SC_Request(height uint64) error {
 	return nil
 }
 
-func GetTimestamp(height uint64) (ts string, err error) {
+// SC variables after the last block of the given height, 0 is the current state
+func SC_GetSnapshotAtHeight(scid string, height uint64) (r GetSC_Result, err error) {
 
-	req := RPC_Request(DAEMON_BLOCK, GetBlock_Params{Height: height})
-	data, err := json.Marshal(req)
-	if err != nil {
-		return "", err
-	}
-	if !xswd.xswd_send(data) {
-		return "", fmt.Errorf("error sending request")
+	var topo int64
+	if height == 0 {
+		// the comparison between daemons needs a fixed block
+		if len(daemons) > 0 {
+			h, err := GetHeight()
+			if err != nil {
+				return r, err
+			}
+			topo = h.TopoHeight
+		}
+	} else {
+		w, err := CurrentWalker()
+		if err != nil {
+			return r, err
+		}
+		if topo, err = w.Resolve(height); err != nil {
+			return r, err
+		}
 	}
 
-	var r GetBlock_Result
-	if err = xswd_response(<-xswd.response, &r); err != nil {
-		return "", err
-	}
+	return SC_GetSnapshot(scid, uint64(topo))
+}
 
-	timestamp := time.UnixMilli(int64(r.Block_Header.Timestamp)).Format(time.DateTime)
+// SC variables at the given topoheight, without touching the sync state
+func SC_GetSnapshot(scid string, topoheight uint64) (r GetSC_Result, err error) {
 
-	return timestamp, nil
+	if err = QuorumCall(DAEMON_GET_SC, SC_Build_GetSC_Request(scid, topoheight), &r, CompareSC); err != nil {
+		return r, err
+	}
+
+	return r, nil
 }
 
-func SC_SendMessage(msg string, ringsize string) (txid string, err error) {
+func GetTransaction(txid string) (tx Tx_Related_Info, err error) {
 
-	var t Transfer_Params
-	p := invoke_params
+	var r GetTransaction_Result
+	if err = xswd.Call(DAEMON_GET_TX, GetTransaction_Params{Tx_Hashes: []string{txid}}, &r); err != nil {
+		return tx, err
+	}
+	if len(r.Txs) == 0 {
+		return tx, fmt.Errorf("transaction not found")
+	}
 
-	p = append(p,
-		SC_AddMessage(msg),
-		Argument{
-			Name:     "SC_ACTION",
-			DataType: "U",
-			Value:    0,
-		},
-		Argument{
-			Name:     "SC_ID",
-			DataType: DataHash,
-			Value:    SC_Config.SCID,
-		})
+	return r.Txs[0], nil
+}
 
-	t.SC_RPC = p
-	t.Ringsize, err = strconv.ParseUint(ringsize, 10, 64)
-	if err != nil {
+// signed transaction as the daemon knows it, from the mempool or the chain
+func GetTransactionHex(txid string) (tx string, err error) {
+
+	var r GetTransaction_Result
+	if err = xswd.Call(DAEMON_GET_TX, GetTransaction_Params{Tx_Hashes: []string{txid}}, &r); err != nil {
 		return "", err
 	}
+	if len(r.Txs_as_hex) == 0 || r.Txs_as_hex[0] == "" {
+		return "", fmt.Errorf("transaction not found")
+	}
 
-	t.Transfers = append(t.Transfers, BuildTransfer())
-	if t.Transfers == nil {
-		return "", fmt.Errorf("empty transfer")
+	return r.Txs_as_hex[0], nil
+}
+
+// submit a signed transaction again, the wallet isn't involved
+func SendRawTransaction(tx string) error {
+
+	log_xswd.Println(">", DAEMON_SEND_RAW_TX)
+	var r SendRawTransaction_Result
+	if err := xswd.Call(DAEMON_SEND_RAW_TX, SendRawTransaction_Params{Tx_as_hex: tx}, &r); err != nil {
+		return err
+	}
+	if r.Status != "OK" {
+		return fmt.Errorf("transaction rejected: %s", r.Status)
 	}
 
-	req := RPC_Request(DAEMON_GAS_ESTIMATE, t)
-	data, err := json.Marshal(req)
+	return nil
+}
+
+// header of the last block at the given height
+func GetBlockHeader(height uint64) (h BlockHeader_Print, err error) {
+
+	w, err := CurrentWalker()
 	if err != nil {
-		return "", err
+		return h, err
 	}
 
-	if !xswd.xswd_send(data) {
-		return "", fmt.Errorf("error sending request")
+	return w.HeaderAt(height)
+}
+
+func GetBlockHeaderByTopo(topo int64) (h BlockHeader_Print, err error) {
+
+	var r GetBlockHeader_Result
+	if err = QuorumCall(DAEMON_BLOCK_HEADER_TOPO, GetBlockHeaderByTopoHeight_Params{TopoHeight: uint64(topo)}, &r, CompareHeader); err != nil {
+		return h, err
 	}
-	log_xswd.Println(">", DAEMON_GAS_ESTIMATE)
 
-	var r GasEstimate_Result
-	if err = xswd_response(<-xswd.response, &r); err != nil {
-		return "", err
+	return r.Block_Header, nil
+}
+
+func GetHeight() (r GetHeight_Result, err error) {
+
+	if err = xswd.Call(DAEMON_GET_HEIGHT, nil, &r); err != nil {
+		return r, err
 	}
 
-	t.Fees = r.GasStorage + tx_fees[t.Ringsize]
+	return r, nil
+}
+
+func SC_SendMessage(scid string, msg string, ringsize string) (txid string, err error) {
 
-	req = RPC_Request(WALLET_TRANSFER, t)
-	data, err = json.Marshal(req)
+	t, _, err := SC_PrepareMessage(scid, msg, ringsize)
 	if err != nil {
 		return "", err
 	}
 
-	if !xswd.xswd_send(data) {
-		return "", fmt.Errorf("error sending request")
-	}
-	log_xswd.Println(">", WALLET_TRANSFER)
+	return SC_Transfer(t)
+}
 
-	var result Transfer_Result
-	if err = xswd_response(<-xswd.response, &r); err != nil {
-		return "", err
+// transfer and fees for a message, to be confirmed before SC_Transfer
+func SC_PrepareMessage(scid string, msg string, ringsize string) (t Transfer_Params, f FeeBreakdown, err error) {
+
+	rs, err := strconv.ParseUint(ringsize, 10, 64)
+	if err != nil {
+		return t, f, err
 	}
 
-	return result.TXID, nil
+	return SC_BuildInvoke(scid, "Store", Arguments{SC_AddMessage(msg)}, rs)
 }
 
-func SC_SyncLoop() (int, error) {
+func SC_Invoke(scid string, entrypoint string, args Arguments, ringsize uint64) (txid string, err error) {
 
-	if err := SC_Request(0); err != nil {
-		return 0, err
+	t, _, err := SC_BuildInvoke(scid, entrypoint, args, ringsize)
+	if err != nil {
+		return "", err
 	}
-	rateLimit.Count = 1
 
-	current_height := SC_Data.Height
+	return SC_Transfer(t)
+}
+
+// arguments of an SC call, the wallet adds nothing when SC_ID is left empty
+func SC_InvokeArguments(scid string, entrypoint string, args Arguments) Arguments {
 
-	if SC_Data.Height == SC_Data.LastUpdate {
-		return 0, nil
+	p := Arguments{
+		Argument{
+			Name:     "entrypoint",
+			DataType: DataString,
+			Value:    entrypoint,
+		},
 	}
+	p = append(p, args...)
+	p = append(p,
+		Argument{
+			Name:     "SC_ACTION",
+			DataType: "U",
+			Value:    0,
+		},
+		Argument{
+			Name:     "SC_ID",
+			DataType: DataHash,
+			Value:    scid,
+		})
 
-	var msg_count int
-	for {
-		plain, err := hex.DecodeString(SC_Data.Msg)
-		if err != nil {
-			continue
-		}
-		contents := DecryptMessages(string(plain))
+	return p
+}
 
-		if len(contents) > 0 {
+func SC_BuildInvoke(scid string, entrypoint string, args Arguments, ringsize uint64) (t Transfer_Params, f FeeBreakdown, err error) {
 
-			for !rateLimit.Check() {
-				time.Sleep(50 * time.Millisecond)
-			}
-			ts, err := GetTimestamp(SC_Data.Height)
-			if err != nil {
-				ts = "#no timestamp"
-			}
-			for _, m := range contents {
-				if m == "" {
-					continue
-				}
-				decrypted_messages = append(decrypted_messages, MsgDecryped{
-					Message: m,
-					Block:   SC_Data.Height,
-					Time:    ts,
-				})
-				msg_count++
-			}
-		}
+	t.SC_RPC = SC_InvokeArguments(scid, entrypoint, args)
+	t.Ringsize = ringsize
 
-		for !rateLimit.Check() {
-			time.Sleep(50 * time.Millisecond)
-		}
-		if err := SC_Request(SC_Data.Prev); err != nil {
-			return msg_count, err
-		}
+	t.Transfers = append(t.Transfers, BuildTransfer())
+	if t.Transfers[0].Destination == "" {
+		return t, f, fmt.Errorf("empty transfer")
+	}
 
-		if SC_Data.Height == SC_Data.Prev || SC_Data.Height == SC_Data.LastUpdate {
-			SC_Data.LastUpdate = current_height
-			break
-		}
+	log_xswd.Println(">", DAEMON_GAS_ESTIMATE)
+	var r GasEstimate_Result
+	if err = xswd.Call(DAEMON_GAS_ESTIMATE, t, &r); err != nil {
+		return t, f, err
+	}
+
+	if f, err = EstimateFees(t, r); err != nil {
+		return t, f, err
 	}
+	t.Fees = f.Total
 
-	return msg_count, nil
+	return t, f, nil
 }
 
-func GetWalletKey() (key *big.Int, err error) {
+// every transaction goes through here, nothing is sent in read-only mode
+func SC_Transfer(t Transfer_Params) (txid string, err error) {
 
-	req := RPC_Request(WALLET_QUERY_KEY, Query_Key_Params{
-		Key_type: "mnemonic",
-	})
-	data, err := json.Marshal(req)
-	if err != nil {
-		return nil, err
+	if read_only.Load() {
+		return "", fmt.Errorf("read-only mode, unknown contract code")
 	}
-	if !xswd.xswd_send(data) {
-		return nil, fmt.Errorf("error sending request")
+
+	log_xswd.Println(">", WALLET_TRANSFER)
+	var result Transfer_Result
+	if err = xswd.Call(WALLET_TRANSFER, t, &result); err != nil {
+		return "", err
 	}
 
+	return result.TXID, nil
+}
+
+func GetWalletKey() (key *big.Int, err error) {
+
 	var r Query_Key_Result
-	if err = xswd_response(<-xswd.response, &r); err != nil {
+	if err = xswd.Call(WALLET_QUERY_KEY, Query_Key_Params{
+		Key_type: "mnemonic",
+	}, &r); err != nil {
 		return nil, err
 	}
 
@@ -213,19 +253,10 @@ func GetWalletKey() (key *big.Int, err error) {
 
 func RPC_GetRandomAddress() string {
 
-	req := RPC_Request(DAEMON_GET_RANDOM_ADDRESS, GetRandomAddress_Params{
-		SCID: ZEROHASH,
-	})
-	data, err := json.Marshal(req)
-	if err != nil {
-		return ""
-	}
-	if !xswd.xswd_send(data) {
-		return ""
-	}
-
 	var r GetRandomAddress_Result
-	if err = xswd_response(<-xswd.response, &r); err != nil {
+	if err := xswd.Call(DAEMON_GET_RANDOM_ADDRESS, GetRandomAddress_Params{
+		SCID: ZEROHASH,
+	}, &r); err != nil {
 		return ""
 	}
 
@@ -238,20 +269,11 @@ func RPC_GetRandomAddress() string {
 
 func RPC_NameToAddress(name string) string {
 
-	req := RPC_Request(DAEMON_NAME_TO_ADDRESS, NameToAddress_Params{
+	var r NameToAddress_Result
+	if err := xswd.Call(DAEMON_NAME_TO_ADDRESS, NameToAddress_Params{
 		Name:       name,
 		TopoHeight: -1,
-	})
-	data, err := json.Marshal(req)
-	if err != nil {
-		return ""
-	}
-	if !xswd.xswd_send(data) {
-		return ""
-	}
-
-	var r NameToAddress_Result
-	if err = xswd_response(<-xswd.response, &r); err != nil {
+	}, &r); err != nil {
 		return ""
 	}
 
@@ -261,6 +283,15 @@ func RPC_NameToAddress(name string) string {
 func ValidateReceivers(r []string) (result []string) {
 
 	for _, a := range r {
+		if addr, ok := ContactAddress(strings.TrimSpace(a)); ok {
+			a = addr
+		}
+		if IsChannel(a) {
+			if name := ChannelName(a); name != "" {
+				result = append(result, CHANNEL_PREFIX+name)
+			}
+			continue
+		}
 		_, err := globals.ParseValidateAddress(a)
 		if err != nil {
 			if w := RPC_NameToAddress(a); w != "" {
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"slices"
+)
+
+const CHECKPOINT_FILE = "checkpoint.json"
+
+// sync state of older releases, imported into the database
+type Checkpoint struct {
+	SCID       string        `json:"scid"`
+	LastUpdate uint64        `json:"last_update"`
+	Prev       uint64        `json:"prev"`
+	Messages   []MsgDecryped `json:"messages"`
+}
+
+// drop everything of the selected contract from the given height on, the next sync fetches it again
+func SC_Rescan(height uint64) error {
+
+	db_mu.Lock()
+	var messages []MsgDecryped
+	for _, m := range decrypted_messages {
+		if m.Block < height || m.SCID != sc_active {
+			messages = append(messages, m)
+		}
+	}
+	decrypted_messages = messages
+	db_mu.Unlock()
+
+	// the unscanned range would be covered by the new one
+	if sync_gap != nil && sync_gap.Top >= height {
+		sync_gap = nil
+	}
+
+	if height > 0 {
+		height--
+	}
+	if SC_Data.LastUpdate > height {
+		SC_Data.LastUpdate = height
+		SC_Data.LastPrev = 0
+	}
+	for h := range block_hashes {
+		if h > height {
+			delete(block_hashes, h)
+		}
+	}
+
+	return SC_Save()
+}
+
+// skip messages we already know
+func AddMessage(m MsgDecryped) bool {
+
+	db_mu.Lock()
+	defer db_mu.Unlock()
+
+	for _, d := range decrypted_messages {
+		if d.SCID == m.SCID && d.Block == m.Block && d.Envelope == m.Envelope && d.TXID == m.TXID {
+			return false
+		}
+	}
+	decrypted_messages = append(decrypted_messages, m)
+
+	return true
+}
+
+// copy of the received messages
+func Messages() []MsgDecryped {
+
+	db_mu.Lock()
+	defer db_mu.Unlock()
+
+	return slices.Clone(decrypted_messages)
+}
@@ -5,28 +5,68 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"slices"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Config struct {
-	SCID      string `json:"scid"`
-	RateLimit uint64 `json:"limiter"`
+	SCID       string     `json:"scid,omitempty"` // single contract of older releases
+	Contracts  []Contract `json:"contracts"`
+	RateLimit  uint64     `json:"limiter"`
+	Burst      uint64     `json:"burst,omitempty"`
+	Workers    int        `json:"workers,omitempty"`
+	Channels   []string   `json:"channels,omitempty"`
+	Registry   string     `json:"registry,omitempty"`
+	Password   bool       `json:"db_passphrase,omitempty"`
+	Daemons    []string   `json:"daemons,omitempty"`
+	Quorum     int        `json:"quorum,omitempty"`
+	MaxFee     uint64     `json:"max_fee,omitempty"`     // atomic units
+	BatchLimit int        `json:"batch_limit,omitempty"` // bytes per batch
+
+	Cover         bool   `json:"cover_traffic,omitempty"`
+	CoverBudget   uint64 `json:"cover_budget,omitempty"`   // atomic units
+	CoverInterval string `json:"cover_interval,omitempty"` // mean time between dummies
+
+	RelayListen string            `json:"relay_listen,omitempty"`
+	RelayTokens map[string]string `json:"relay_tokens,omitempty"` // token -> submitter
+	RelayBatch  int               `json:"relay_batch,omitempty"`  // envelopes per batch
+	RelayDelay  string            `json:"relay_delay,omitempty"`  // longest wait for a batch
+
+	Stamp    int `json:"pow_stamp,omitempty"` // difficulty in bits of sent envelopes
+	MinStamp int `json:"min_pow,omitempty"`   // envelopes below are skipped
 }
 type SCData struct {
 	Height     uint64
 	Prev       uint64
 	Msg        string
 	LastUpdate uint64
+	LastPrev   uint64
 }
 type MsgDecryped struct {
-	Message string
-	Block   uint64
-	Time    string
+	Message      string
+	Channel      string
+	Block        uint64
+	Time         string
+	TTL          TTL
+	ExpireHeight uint64
+	ExpireTime   time.Time
+	Envelope     string
+	Index        int
+	SCID         string
+	TXID         string `json:",omitempty"` // TX payload messages
+	Sender       string `json:",omitempty"`
 }
+
+// token bucket, shared by all RPC calls
 type Limiter struct {
-	Init  time.Time
-	Count uint64
+	Rate   float64
+	Burst  float64
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
 }
 
 var log_xswd = log.New(os.Stdout, "dShout > ", log.Ldate|log.Ltime)
@@ -35,18 +75,13 @@ var SC_Config Config
 var SC_Data SCData
 var lastCheck uint64
 
+// updated by the sync and the expiry countdown
+var chain_height atomic.Uint64
+var stable_height atomic.Uint64
+
 var decrypted_messages []MsgDecryped
-var tx_fees = map[uint64]uint64{
-	2:   40,
-	4:   60,
-	8:   60,
-	16:  80,
-	32:  100,
-	64:  120,
-	128: 180,
-}
 
-var rateLimit Limiter
+var rateLimit = NewLimiter(0, 0)
 
 func ReadConfig() error {
 
@@ -58,10 +93,76 @@ func ReadConfig() error {
 	if err := json.Unmarshal(data, &SC_Config); err != nil {
 		return err
 	}
+	if SC_Config.SCID != "" {
+		if _, ok := GetContract(SC_Config.SCID); !ok {
+			SC_Config.Contracts = append([]Contract{{Name: "dShout", SCID: SC_Config.SCID}}, SC_Config.Contracts...)
+		}
+		SC_Config.SCID = ""
+	}
+	if len(SC_Config.Contracts) == 0 {
+		return fmt.Errorf("no contract configured")
+	}
+	if SC_Config.Workers < 1 {
+		SC_Config.Workers = 4
+	}
+	rateLimit = NewLimiter(SC_Config.RateLimit, SC_Config.Burst)
 
 	return nil
 }
 
+func SaveConfig() error {
+
+	data, err := json.MarshalIndent(SC_Config, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile("config.json", data, 0644)
+}
+
+func SubscribeChannel(name string) error {
+
+	name = ChannelName(name)
+	if name == "" {
+		return fmt.Errorf("empty channel name")
+	}
+	if slices.Contains(SC_Config.Channels, name) {
+		return fmt.Errorf("already subscribed to #%s", name)
+	}
+	if !sync_mu.TryLock() {
+		return ErrSyncRunning
+	}
+	defer sync_mu.Unlock()
+	SC_Config.Channels = append(SC_Config.Channels, name)
+	SC_ResetSync()
+
+	return SaveConfig()
+}
+
+func UnsubscribeChannel(name string) error {
+
+	name = ChannelName(name)
+	i := slices.Index(SC_Config.Channels, name)
+	if i < 0 {
+		return fmt.Errorf("not subscribed to #%s", name)
+	}
+	if !sync_mu.TryLock() {
+		return ErrSyncRunning
+	}
+	defer sync_mu.Unlock()
+	SC_Config.Channels = slices.Delete(SC_Config.Channels, i, i+1)
+	SC_ResetSync()
+
+	return SaveConfig()
+}
+
+// channel keys changed, scan the whole history again, the caller holds sync_mu
+func SC_ResetSync() {
+	if err := sc_rescan_all(0); err != nil {
+		log_xswd.Println("Can't save database:", err)
+	}
+}
+
 func Parse_SC(r GetSC_Result) error {
 
 	if !SC_SanityCheck(r) {
@@ -100,25 +201,50 @@ func SC_UpdateData(r GetSC_Result) {
 	SC_Data.Msg = r.ValuesString[2]
 }
 
-func SC_Build_GetSC_Request(height uint64) GetSC_Params {
+func SC_Build_GetSC_Request(scid string, topoheight uint64) GetSC_Params {
 	return GetSC_Params{
-		SCID:       SC_Config.SCID,
-		TopoHeight: height,
+		SCID:       scid,
+		TopoHeight: topoheight,
 		KeysString: []string{"height", "prev", "msg"},
 	}
 }
 
-func (l *Limiter) Check() bool {
-	if time.Since(l.Init) > time.Second {
-		l.Init = time.Now()
-		l.Count = 1
+// rate is in requests per second, 0 disables the limiter
+func NewLimiter(rate uint64, burst uint64) *Limiter {
 
-		return true
+	if burst == 0 {
+		burst = rate
 	}
-	l.Count++
-	if l.Count >= SC_Config.RateLimit {
-		return false
+
+	return &Limiter{
+		Rate:   float64(rate),
+		Burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
 	}
+}
 
-	return true
+// block until a token is available
+func (l *Limiter) Wait() {
+
+	if l.Rate <= 0 {
+		return
+	}
+
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens = min(l.Burst, l.tokens+now.Sub(l.last).Seconds()*l.Rate)
+		l.last = now
+
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return
+		}
+		wait := time.Duration((1 - l.tokens) / l.Rate * float64(time.Second))
+		l.mu.Unlock()
+
+		time.Sleep(wait)
+	}
 }
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+)
+
+// deployment of the Store contract
+type Contract struct {
+	Name string `json:"name"`
+	SCID string `json:"scid"`
+}
+
+// sync state of every contract by SCID, the selected one lives in SC_Data,
+// block_hashes and sync_gap. Those belong to the goroutine holding sync_mu,
+// sync_states is shared with DB_Save under db_mu
+var sync_states = map[string]*SyncState{}
+var sc_active string
+
+// make the sync state of a contract current
+func SC_Select(scid string) {
+
+	SC_StoreState()
+
+	db_mu.Lock()
+	s, ok := sync_states[scid]
+	if !ok {
+		s = &SyncState{}
+		sync_states[scid] = s
+	}
+	state := *s
+	db_mu.Unlock()
+	sc_active = scid
+
+	SC_Data = SCData{LastUpdate: state.LastUpdate, LastPrev: state.LastPrev}
+	block_hashes = maps.Clone(state.Hashes)
+	if block_hashes == nil {
+		block_hashes = map[uint64]string{}
+	}
+	sync_gap = nil
+	if state.Gap != nil {
+		gap := *state.Gap
+		sync_gap = &gap
+	}
+}
+
+// publish a copy of the selected contract's sync state for DB_Save
+func SC_StoreState() {
+
+	if sc_active == "" {
+		return
+	}
+	s := &SyncState{
+		LastUpdate: SC_Data.LastUpdate,
+		LastPrev:   SC_Data.LastPrev,
+		Hashes:     maps.Clone(block_hashes),
+	}
+	if sync_gap != nil {
+		gap := *sync_gap
+		s.Gap = &gap
+	}
+
+	db_mu.Lock()
+	sync_states[sc_active] = s
+	db_mu.Unlock()
+}
+
+// save the database with the current sync state
+func SC_Save() error {
+
+	SC_StoreState()
+
+	return DB_Save()
+}
+
+func ContractNames() (names []string) {
+
+	for _, c := range SC_Config.Contracts {
+		names = append(names, c.Name)
+	}
+
+	return
+}
+
+func GetContractByName(name string) (Contract, bool) {
+
+	for _, c := range SC_Config.Contracts {
+		if c.Name == name {
+			return c, true
+		}
+	}
+
+	return Contract{}, false
+}
+
+func GetContract(scid string) (Contract, bool) {
+
+	for _, c := range SC_Config.Contracts {
+		if c.SCID == scid {
+			return c, true
+		}
+	}
+
+	return Contract{}, false
+}
+
+// label for the inbox
+func ContractName(scid string) string {
+
+	if c, ok := GetContract(scid); ok {
+		return c.Name
+	}
+	if len(scid) > 8 {
+		return scid[:8]
+	}
+
+	return scid
+}
+
+func AddContract(name string, scid string) error {
+
+	if !sync_mu.TryLock() {
+		return ErrSyncRunning
+	}
+	defer sync_mu.Unlock()
+
+	if name == "" {
+		return fmt.Errorf("empty contract name")
+	}
+	if len(scid) != 64 {
+		return fmt.Errorf("invalid SCID")
+	}
+	for _, c := range SC_Config.Contracts {
+		if c.Name == name {
+			return fmt.Errorf("contract %s already exists", name)
+		}
+		if c.SCID == scid {
+			return fmt.Errorf("SCID already added as %s", c.Name)
+		}
+	}
+	SC_Config.Contracts = append(SC_Config.Contracts, Contract{Name: name, SCID: scid})
+
+	return SaveConfig()
+}
+
+// sync state and messages of the contract are kept in the database
+func RemoveContract(name string) error {
+
+	if !sync_mu.TryLock() {
+		return ErrSyncRunning
+	}
+	defer sync_mu.Unlock()
+
+	if len(SC_Config.Contracts) == 1 {
+		return fmt.Errorf("can't remove the last contract")
+	}
+	for i, c := range SC_Config.Contracts {
+		if c.Name == name {
+			SC_Config.Contracts = append(SC_Config.Contracts[:i], SC_Config.Contracts[i+1:]...)
+			set_unverified(c.SCID, false)
+			return SaveConfig()
+		}
+	}
+
+	return fmt.Errorf("unknown contract %s", name)
+}
+
+// drop everything of all contracts from the given height on
+func SC_RescanAll(height uint64) error {
+
+	if !sync_mu.TryLock() {
+		return ErrSyncRunning
+	}
+	defer sync_mu.Unlock()
+
+	return sc_rescan_all(height)
+}
+
+// the caller holds sync_mu
+func sc_rescan_all(height uint64) error {
+
+	active := sc_active
+	defer func() {
+		if active != "" {
+			SC_Select(active)
+		}
+	}()
+
+	for _, c := range SC_Config.Contracts {
+		SC_Select(c.SCID)
+		if err := SC_Rescan(height); err != nil {
+			return err
+		}
+	}
+	db_mu.Lock()
+	payload_height = min(payload_height, height)
+	db_mu.Unlock()
+
+	return nil
+}
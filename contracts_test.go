@@ -0,0 +1,117 @@
+package main
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+const (
+	TEST_SCID_A = "a8ee7e571130342e0b7baa9052ccbfe3c1766cc454403721d2a357e7eda14894"
+	TEST_SCID_B = "b8ee7e571130342e0b7baa9052ccbfe3c1766cc454403721d2a357e7eda14894"
+)
+
+// empty database with two contracts in a temporary directory
+func test_db(t *testing.T) {
+
+	t.Helper()
+
+	t.Chdir(t.TempDir())
+	config := SC_Config
+	t.Cleanup(func() {
+		SC_Config = config
+		sc_active = ""
+		db_open = false
+	})
+
+	SC_Config.Contracts = []Contract{{Name: "a", SCID: TEST_SCID_A}, {Name: "b", SCID: TEST_SCID_B}}
+	test_identity(t)
+	if err := DB_Open(""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSelectContract(t *testing.T) {
+
+	test_db(t)
+
+	SC_Select(TEST_SCID_A)
+	SC_Data.LastUpdate = 10
+	block_hashes[5] = "hash"
+	sync_gap = &SyncGap{Height: 7, Top: 9}
+
+	SC_Select(TEST_SCID_B)
+	if SC_Data.LastUpdate != 0 || len(block_hashes) != 0 || sync_gap != nil {
+		t.Fatalf("state of A leaked into B: %+v %v %v", SC_Data, block_hashes, sync_gap)
+	}
+	block_hashes[6] = "other"
+
+	SC_Select(TEST_SCID_A)
+	if SC_Data.LastUpdate != 10 || !maps.Equal(block_hashes, map[uint64]string{5: "hash"}) || sync_gap == nil || sync_gap.Height != 7 {
+		t.Fatalf("state of A not restored: %+v %v %v", SC_Data, block_hashes, sync_gap)
+	}
+
+	// the published state is a copy, the working state can change meanwhile
+	sync_gap.Height = 8
+	block_hashes[8] = "new"
+	if s := sync_states[TEST_SCID_A]; s.Gap.Height != 7 || len(s.Hashes) != 1 {
+		t.Errorf("published state changed: %+v", s)
+	}
+}
+
+func TestRescanAll(t *testing.T) {
+
+	test_db(t)
+
+	for _, c := range SC_Config.Contracts {
+		SC_Select(c.SCID)
+		SC_Data.LastUpdate = 20
+		block_hashes[15] = "hash"
+		AddMessage(MsgDecryped{SCID: c.SCID, Block: 5, Envelope: "old"})
+		AddMessage(MsgDecryped{SCID: c.SCID, Block: 15, Envelope: "new"})
+	}
+	payload_height = 30
+
+	if err := SC_RescanAll(10); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range Messages() {
+		if m.Block >= 10 {
+			t.Errorf("message at height %d kept", m.Block)
+		}
+	}
+	if n := len(Messages()); n != 2 {
+		t.Errorf("%d messages left, want 2", n)
+	}
+	for _, c := range SC_Config.Contracts {
+		SC_Select(c.SCID)
+		if SC_Data.LastUpdate != 9 || len(block_hashes) != 0 {
+			t.Errorf("%s: last update %d, hashes %v", c.Name, SC_Data.LastUpdate, block_hashes)
+		}
+	}
+	if payload_height != 10 {
+		t.Errorf("payload height %d, want 10", payload_height)
+	}
+}
+
+func TestSyncRunning(t *testing.T) {
+
+	test_db(t)
+
+	sync_mu.Lock()
+	defer sync_mu.Unlock()
+
+	if err := SC_RescanAll(0); err != ErrSyncRunning {
+		t.Errorf("SC_RescanAll: %v", err)
+	}
+	if err := SubscribeChannel("dero"); err != ErrSyncRunning {
+		t.Errorf("SubscribeChannel: %v", err)
+	}
+	if err := AddContract("c", strings.Repeat("c", 64)); err != ErrSyncRunning {
+		t.Errorf("AddContract: %v", err)
+	}
+	if err := RemoveContract("b"); err != ErrSyncRunning || len(SC_Config.Contracts) != 2 {
+		t.Errorf("RemoveContract: %v", err)
+	}
+}
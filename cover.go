@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/mlkem"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/deroproject/derohe/cryptography/bn256"
+	"github.com/deroproject/derohe/cryptography/crypto"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// dummy envelopes look like messages: same format, receiver count, ML-KEM entries,
+// ringsize and message sizes as the user's own envelopes
+const (
+	COVER_INTERVAL      = time.Hour // default mean time between dummies
+	COVER_RINGSIZE      = "16"      // shape without any sent envelope
+	COVER_MAX_RECEIVERS = 4
+	COVER_MIN_LENGTH    = 40
+	COVER_MAX_LENGTH    = 400
+)
+
+// fees spent on cover traffic, counted against cover_budget, guarded by db_mu
+var cover_spent uint64
+var cover_sent int
+
+type CoverShape struct {
+	Receivers  int
+	PQ         bool
+	Ciphertext int // bytes
+	Ringsize   string
+}
+
+// shape of a random envelope generated here, random without any
+func CoverPickShape() CoverShape {
+
+	var own []OutboxItem
+	for _, o := range OutboxItems() {
+		if o.Key != "" && SanityCheck(o.Envelope) {
+			own = append(own, o)
+		}
+	}
+	if len(own) == 0 {
+		return CoverShape{
+			Receivers:  1 + int(random_below(COVER_MAX_RECEIVERS)),
+			Ciphertext: COVER_MIN_LENGTH + int(random_below(COVER_MAX_LENGTH-COVER_MIN_LENGTH+1)),
+			Ringsize:   COVER_RINGSIZE,
+		}
+	}
+
+	o := own[random_below(uint64(len(own)))]
+	_, commits := GetCommitments(o.Envelope)
+	entries, payload := GetPQ(GetPayload(o.Envelope))
+
+	return CoverShape{
+		Receivers:  len(commits),
+		PQ:         len(entries) > 0,
+		Ciphertext: len(payload) / 2,
+		Ringsize:   o.Ringsize,
+	}
+}
+
+// build an envelope for random keys and maybe our own one, the plaintext has no identifier,
+// so every receiver drops it, we just don't keep the key
+func CoverEnvelope(shape CoverShape) (string, error) {
+
+	k := crypto.RandomScalar()
+	pub := hex.EncodeToString(new(bn256.G1).ScalarMult(crypto.G, k).EncodeCompressed())
+	sy := new(bn256.G1).ScalarMult(crypto.G, crypto.RandomScalar())
+
+	var commits string
+	self := random_below(2) == 0
+	for i := range shape.Receivers {
+		r_pub := new(bn256.G1).ScalarMult(crypto.G, crypto.RandomScalar())
+		if i == 0 && self {
+			r_pub = new(bn256.G1).ScalarMult(crypto.G, privateKey)
+		}
+		commit := new(bn256.G1).Add(new(bn256.G1).Set(sy), new(bn256.G1).ScalarMult(r_pub, k))
+		commits += hex.EncodeToString(commit.EncodeCompressed())
+	}
+
+	// real ML-KEM ciphertexts for random keys, nobody can decapsulate them
+	var pq string
+	if shape.PQ {
+		for range shape.Receivers {
+			dk, err := mlkem.GenerateKey768()
+			if err != nil {
+				return "", err
+			}
+			var wrap [32]byte
+			rand.Read(wrap[:])
+			_, ct := dk.EncapsulationKey().Encapsulate()
+			pq += hex.EncodeToString(append(ct, wrap[:]...))
+		}
+		pq += PQ_SEPARATOR
+	}
+
+	overhead := chacha20poly1305.Overhead + chacha20poly1305.NonceSize
+	plain := make([]byte, max(shape.Ciphertext-overhead, 0))
+	rand.Read(plain)
+	enc, err := EncryptMessageWithKey(sha256.Sum256(sy.EncodeCompressed()), plain)
+	if err != nil {
+		return "", err
+	}
+
+	return pub + commits + "x" + pq + hex.EncodeToString(enc), nil
+}
+
+// send one dummy to a random contract, as long as the budget covers its fees
+func CoverSend() (txid string, err error) {
+
+	if len(SC_Config.Contracts) == 0 {
+		return "", fmt.Errorf("no contract configured")
+	}
+	c := SC_Config.Contracts[random_below(uint64(len(SC_Config.Contracts)))]
+
+	shape := CoverPickShape()
+	envelope, err := CoverEnvelope(shape)
+	if err != nil {
+		return "", err
+	}
+	// stamped like the user's envelopes
+	if SC_Config.Stamp > 0 {
+		h, err := GetHeight()
+		if err != nil {
+			return "", err
+		}
+		envelope = RenewStamp(envelope, c.SCID, h.Height)
+	}
+	t, f, err := SC_PrepareMessage(c.SCID, envelope, shape.Ringsize)
+	if err != nil {
+		return "", err
+	}
+	db_mu.Lock()
+	spent := cover_spent
+	db_mu.Unlock()
+	if spent+f.Total > SC_Config.CoverBudget {
+		return "", fmt.Errorf("cover traffic budget of %s DERO used up", FormatDERO(SC_Config.CoverBudget))
+	}
+
+	if !send_begin() {
+		return "", ErrShutdown
+	}
+	defer send_end()
+	if txid, err = SC_Transfer(t); err != nil {
+		return "", err
+	}
+	db_mu.Lock()
+	cover_spent += f.Total
+	cover_sent++
+	db_mu.Unlock()
+
+	return txid, DB_Save()
+}
+
+// random intervals of a Poisson process, activity doesn't follow any pattern
+func CoverDelay(mean time.Duration) time.Duration {
+
+	u := (float64(random_below(1<<53)) + 1) / (1 << 53)
+
+	return time.Duration(-math.Log(u) * float64(mean))
+}
+
+func CoverLoop() {
+
+	if !SC_Config.Cover {
+		return
+	}
+
+	mean := COVER_INTERVAL
+	if d, err := time.ParseDuration(SC_Config.CoverInterval); err == nil && d > 0 {
+		mean = d
+	}
+
+	for {
+		time.Sleep(CoverDelay(mean))
+		if !xswd.Connected() || read_only.Load() {
+			continue
+		}
+		if _, err := CoverSend(); err != nil {
+			log_xswd.Println("Cover traffic:", err)
+		}
+	}
+}
+
+func CoverStatus() string {
+
+	if !SC_Config.Cover {
+		return "Cover traffic is disabled"
+	}
+
+	db_mu.Lock()
+	defer db_mu.Unlock()
+
+	return fmt.Sprintf("Dummies sent: %d\nSpent: %s of %s DERO", cover_sent, FormatDERO(cover_spent), FormatDERO(SC_Config.CoverBudget))
+}
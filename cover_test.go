@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/deroproject/derohe/cryptography/crypto"
+)
+
+func TestCoverShape(t *testing.T) {
+
+	test_db(t)
+	me := test_identity(t)
+	other := test_address(t, crypto.RandomScalar())
+
+	// nothing sent yet, a random shape
+	if s := CoverPickShape(); s.Ringsize != COVER_RINGSIZE || s.Receivers < 1 || s.PQ {
+		t.Errorf("default shape %+v", s)
+	}
+
+	envelope, key := test_envelope(t, "a message of the user", true, me, other)
+	if _, err := OutboxAdd(TEST_SCID_A, envelope, "64", key, []string{me, other}, Schedule{Height: 1}); err != nil {
+		t.Fatal(err)
+	}
+	_, payload := GetPQ(GetPayload(envelope))
+
+	want := CoverShape{Receivers: 2, PQ: true, Ciphertext: len(payload) / 2, Ringsize: "64"}
+	if s := CoverPickShape(); s != want {
+		t.Errorf("shape %+v, want %+v", s, want)
+	}
+}
+
+func TestCoverEnvelope(t *testing.T) {
+
+	test_identity(t)
+
+	for _, shape := range []CoverShape{
+		{Receivers: 1, Ciphertext: 100},
+		{Receivers: 3, PQ: true, Ciphertext: 250},
+	} {
+		envelope, err := CoverEnvelope(shape)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !SanityCheck(envelope) {
+			t.Fatalf("%+v: invalid envelope", shape)
+		}
+
+		_, commits := GetCommitments(envelope)
+		entries, payload := GetPQ(GetPayload(envelope))
+		if len(commits) != shape.Receivers || len(payload)/2 != shape.Ciphertext {
+			t.Errorf("%+v: %d receivers, %d bytes", shape, len(commits), len(payload)/2)
+		}
+		if shape.PQ && len(entries) != shape.Receivers || !shape.PQ && len(entries) != 0 {
+			t.Errorf("%+v: %d ML-KEM entries", shape, len(entries))
+		}
+
+		// dropped by every receiver, including us
+		if m := DecryptMessages(envelope); len(m) != 0 {
+			t.Errorf("%+v: dummy decrypted", shape)
+		}
+	}
+}
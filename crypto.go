@@ -20,6 +20,12 @@ const INDENTIFIER = "<DERO ENCRYPTED>"
 const MSG_INPUT = 28 - len(INDENTIFIER)
 const MSG_MIN_LENGTH = 189
 const ZEROHASH = "0000000000000000000000000000000000000000000000000000000000000000"
+const CHANNEL_PREFIX = "#"
+
+type ReadKey struct {
+	Channel string
+	Key     *big.Int
+}
 
 var privateKey *big.Int
 
@@ -37,11 +43,16 @@ func GenerateSharedSecrets(receivers []string) (public_key string, shared_keys [
 	sy := new(bn256.G1).ScalarMult(crypto.G, s)
 
 	for _, a := range receivers {
-		addr, _ := globals.ParseValidateAddress(a)
+		var r_pub *bn256.G1
 
-		r_pub, err := bn256.Decompress(addr.PublicKey.EncodeCompressed())
-		if err != nil {
-			return "", nil, key, err
+		if IsChannel(a) {
+			r_pub = new(bn256.G1).ScalarMult(crypto.G, ChannelKey(a))
+		} else {
+			addr, _ := globals.ParseValidateAddress(a)
+
+			if r_pub, err = bn256.Decompress(addr.PublicKey.EncodeCompressed()); err != nil {
+				return "", nil, key, err
+			}
 		}
 
 		shared_key := new(bn256.G1).Add(new(bn256.G1).Set(sy), new(bn256.G1).ScalarMult(r_pub, k))
@@ -87,7 +98,8 @@ func AddKeyword(msg string) string {
 func EncryptMessage(msg string, key [32]byte) (encrypted string, modified string, err error) {
 
 	if !strings.Contains(msg, INDENTIFIER) {
-		msg = AddKeyword(msg)
+		ttl, body := GetTTL(msg)
+		msg = AddTTL(AddKeyword(body), ttl)
 	}
 	data, err := EncryptMessageWithKey(key, []byte(msg))
 	if err != nil {
@@ -141,35 +153,53 @@ func DecryptMessageWithKey(Key [32]byte, Data []byte) (result []byte, err error)
 }
 
 // message decryption
-func DecryptMessages(data string) (contents []string) {
+func DecryptMessages(data string) (contents []MsgDecryped) {
 
 	for _, m := range GetMessages(data) {
 		if !SanityCheck(m) {
 			continue
 		}
 		pub, commits := GetCommitments(m)
-		msg_hex, err := PayloadCheck(GetPayload(m))
+		pq, payload := GetPQ(GetPayload(m))
+		msg_hex, err := PayloadCheck(payload)
 		if err != nil {
 			continue
 		}
-		if content, err := Decrypt(msg_hex, pub, commits); err != nil {
-			continue
-		} else {
-			contents = append(contents, content)
+		for _, k := range ReadKeys() {
+			content, index, err := Decrypt(msg_hex, pub, commits, k.Key, pq)
+			if err != nil || content == "" {
+				continue
+			}
+			contents = append(contents, MsgDecryped{
+				Message:  content,
+				Channel:  k.Channel,
+				Envelope: m,
+				Index:    index,
+			})
+			break
 		}
 	}
 
 	return
 }
 
-func Decrypt(msg []byte, pubkey []byte, commits [][]byte) (content string, err error) {
+func Decrypt(msg []byte, pubkey []byte, commits [][]byte, key *big.Int, pq [][]byte) (content string, index int, err error) {
 
-	shared_keys, err := GetSharedKeys(pubkey, commits)
+	shared_keys, err := GetSharedKeys(pubkey, commits, key)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 
-	for _, k := range shared_keys {
+	for i, k := range shared_keys {
+		// hybrid envelopes have one ML-KEM entry per commitment
+		if pq != nil {
+			if i >= len(pq) {
+				continue
+			}
+			if k, err = HybridUnwrap(k, pq[i]); err != nil {
+				continue
+			}
+		}
 		decrypted, err := DecryptMessageWithKey(k, msg)
 		if err != nil {
 			continue
@@ -183,9 +213,24 @@ func Decrypt(msg []byte, pubkey []byte, commits [][]byte) (content string, err e
 			continue
 		}
 		content = string(plain)
+		index = i
 	}
 
-	return content, nil
+	return content, index, nil
+}
+
+// wallet key and keys of all subscribed channels
+func ReadKeys() (keys []ReadKey) {
+
+	keys = append(keys, ReadKey{Key: privateKey})
+	for _, c := range SC_Config.Channels {
+		keys = append(keys, ReadKey{
+			Channel: ChannelName(c),
+			Key:     ChannelKey(c),
+		})
+	}
+
+	return
 }
 
 // split multiple messages
@@ -245,8 +290,9 @@ func GetCommitments(msg string) (p []byte, c [][]byte) {
 	return
 }
 
-// payload handling
+// payload handling, without the stamp
 func GetPayload(msg string) string {
+	msg, _, _ = GetStamp(msg)
 	return msg[strings.Index(msg, "x")+1:]
 }
 
@@ -257,14 +303,14 @@ func PayloadCheck(msg string) ([]byte, error) {
 }
 
 // get shared keys
-func GetSharedKeys(pubkey []byte, commits [][]byte) (shared_keys [][32]byte, err error) {
+func GetSharedKeys(pubkey []byte, commits [][]byte, key *big.Int) (shared_keys [][32]byte, err error) {
 
 	commit := new(bn256.G1)
 	pub, _ := bn256.Decompress(pubkey)
 
 	for _, c := range commits {
 		commit, _ = bn256.Decompress(c)
-		shared := new(bn256.G1).Add(new(bn256.G1).Set(commit), new(bn256.G1).Neg(new(bn256.G1).ScalarMult(pub, privateKey)))
+		shared := new(bn256.G1).Add(new(bn256.G1).Set(commit), new(bn256.G1).Neg(new(bn256.G1).ScalarMult(pub, key)))
 		shared_keys = append(shared_keys, sha256.Sum256(shared.EncodeCompressed()))
 	}
 
@@ -275,3 +321,17 @@ func GetSharedKeys(pubkey []byte, commits [][]byte) (shared_keys [][32]byte, err
 func HasIdentifier(msg string) bool {
 	return strings.Contains(msg, INDENTIFIER)
 }
+
+// channel handling
+func IsChannel(receiver string) bool {
+	return strings.HasPrefix(strings.TrimSpace(receiver), CHANNEL_PREFIX)
+}
+
+func ChannelName(name string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), CHANNEL_PREFIX))
+}
+
+// everyone who knows the channel name can derive its private key
+func ChannelKey(name string) *big.Int {
+	return crypto.ReducedHash([]byte("dShout channel " + ChannelName(name)))
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/deroproject/derohe/cryptography/bn256"
+	"github.com/deroproject/derohe/cryptography/crypto"
+	"github.com/deroproject/derohe/rpc"
+)
+
+// fresh wallet key, returns its address
+func test_identity(t *testing.T) string {
+
+	t.Helper()
+
+	privateKey = crypto.RandomScalar()
+	mlkemKey = nil
+
+	return test_address(t, privateKey)
+}
+
+func test_address(t *testing.T, key *big.Int) string {
+
+	t.Helper()
+
+	pub := new(bn256.G1).ScalarMult(crypto.G, key)
+	addr, err := rpc.NewAddressFromCompressedKeys(pub.EncodeCompressed())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return addr.String()
+}
+
+// envelope as built by "Generate output", pq adds an ML-KEM entry for our own key
+func test_envelope(t *testing.T, msg string, pq bool, receivers ...string) (envelope string, key [32]byte) {
+
+	t.Helper()
+
+	p, keys, key, err := GenerateSharedSecrets(receivers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var entries string
+	if pq {
+		dk, err := MLKEMKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var secret [32]byte
+		rand.Read(secret[:])
+		for range receivers {
+			shared, ct := dk.EncapsulationKey().Encapsulate()
+			wrap := PQWrap(secret, shared)
+			entries += hex.EncodeToString(append(ct, wrap[:]...))
+		}
+		entries += PQ_SEPARATOR
+		key = HybridKey(key, secret)
+	}
+
+	enc, _, err := EncryptMessage(msg, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope = p
+	for _, k := range keys {
+		envelope += k
+	}
+
+	return envelope + "x" + entries + enc, key
+}
+
+func TestDecryptMessages(t *testing.T) {
+
+	me := test_identity(t)
+	other := test_address(t, crypto.RandomScalar())
+
+	envelope, _ := test_envelope(t, "meet me at the usual place at noon", false, other, me)
+	if !SanityCheck(envelope) {
+		t.Fatal("SanityCheck rejects a valid envelope")
+	}
+
+	m := DecryptMessages(envelope)
+	if len(m) != 1 {
+		t.Fatalf("got %d messages, want 1", len(m))
+	}
+	if !HasIdentifier(m[0].Message) || m[0].Index != 1 || m[0].Envelope != envelope {
+		t.Errorf("unexpected message %+v", m[0])
+	}
+
+	// not for us
+	foreign, _ := test_envelope(t, "meet me at the usual place at noon", false, other)
+	if m := DecryptMessages(foreign); len(m) != 0 {
+		t.Errorf("decrypted a foreign message: %+v", m)
+	}
+
+	// several messages of one block
+	if m := DecryptMessages(envelope + "+" + foreign + "+" + envelope); len(m) != 2 {
+		t.Errorf("got %d messages from a joined block, want 2", len(m))
+	}
+}
+
+func TestDecryptChannel(t *testing.T) {
+
+	test_identity(t)
+	defer func(c []string) { SC_Config.Channels = c }(SC_Config.Channels)
+
+	envelope, _ := test_envelope(t, "hello everyone on this channel", false, "#Dero")
+
+	SC_Config.Channels = nil
+	if m := DecryptMessages(envelope); len(m) != 0 {
+		t.Fatal("decrypted a channel message without subscription")
+	}
+
+	SC_Config.Channels = []string{"dero"}
+	m := DecryptMessages(envelope)
+	if len(m) != 1 || m[0].Channel != "dero" {
+		t.Fatalf("channel message not decrypted: %+v", m)
+	}
+}
+
+func TestDecryptHybrid(t *testing.T) {
+
+	me := test_identity(t)
+
+	envelope, _ := test_envelope(t, "post-quantum hello to a single receiver", true, me)
+	entries, _ := GetPQ(GetPayload(envelope))
+	if len(entries) != 1 {
+		t.Fatalf("got %d ML-KEM entries, want 1", len(entries))
+	}
+	if m := DecryptMessages(envelope); len(m) != 1 {
+		t.Fatalf("hybrid message not decrypted")
+	}
+
+	// the classic key alone doesn't open it
+	_, payload := GetPQ(GetPayload(envelope))
+	data, _ := hex.DecodeString(payload)
+	pub, commits := GetCommitments(envelope)
+	if content, _, _ := Decrypt(data, pub, commits, privateKey, nil); content != "" {
+		t.Error("hybrid message decrypted without ML-KEM entry")
+	}
+}
+
+func TestSanityCheck(t *testing.T) {
+
+	me := test_identity(t)
+	envelope, _ := test_envelope(t, "meet me at the usual place at noon", false, me)
+
+	tests := []struct {
+		name     string
+		envelope string
+		valid    bool
+	}{
+		{"valid", envelope, true},
+		{"short", envelope[:MSG_MIN_LENGTH-1], false},
+		{"no separator", "00" + envelope[:66*2] + envelope[66*2+1:], false},
+		{"two separators", envelope + "x00", false},
+		{"only public key", envelope[:66] + "x" + envelope[66*2+1:], false},
+		{"invalid point", fmt.Sprintf("%066d", 0) + envelope[66:], false},
+	}
+	for _, tt := range tests {
+		if got := SanityCheck(tt.envelope); got != tt.valid {
+			t.Errorf("%s: SanityCheck = %v, want %v", tt.name, got, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// how often the daemon mode checks for messages
+const DAEMON_SYNC_INTERVAL = 5 * time.Minute
+
+// passphrase of the database in daemon mode
+const DAEMON_PASSPHRASE_ENV = "DSHOUT_PASSPHRASE"
+
+// headless mode, sends queued and scheduled outbox entries and checks for messages
+func RunDaemon() error {
+
+	if err := DaemonOpen(); err != nil {
+		return err
+	}
+
+	return daemon_loop()
+}
+
+// a passphrase protected database is opened with the passphrase from the environment,
+// otherwise it's open already
+func DaemonOpen() error {
+
+	if !SC_Config.Password {
+		return nil
+	}
+	if err := DB_Open(os.Getenv(DAEMON_PASSPHRASE_ENV)); err != nil {
+		return fmt.Errorf("can't open database (passphrase is read from %s): %s", DAEMON_PASSPHRASE_ENV, err)
+	}
+
+	return nil
+}
+
+func daemon_loop() error {
+
+	log_xswd.Println("Daemon mode, press Ctrl+C to stop")
+
+	go OutboxLoop()
+	go CoverLoop()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ticker := time.NewTicker(DAEMON_SYNC_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if count, err := SC_SyncLoop(ctx, nil); err != nil {
+				log_xswd.Println("Sync:", err)
+			} else if count > 0 {
+				log_xswd.Printf("Found %d message(s)\n", count)
+			}
+		}()
+
+		select {
+		case <-stop:
+			cancel()
+			<-done
+			return daemon_stop()
+		case <-done:
+		}
+
+		select {
+		case <-stop:
+			return daemon_stop()
+		case <-ticker.C:
+		}
+	}
+}
+
+// a transaction handed to the wallet is recorded before the database is saved
+func daemon_stop() error {
+
+	log_xswd.Println("Stopping daemon, waiting for running sends")
+	SendShutdown()
+
+	return DB_Save()
+}
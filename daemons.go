@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// daemon reached directly over HTTP, used to cross-check the wallet's daemon
+type Daemon struct {
+	Address string
+	client  *http.Client
+}
+
+var daemons []*Daemon
+
+// differences between the sources, newest last
+const QUORUM_REPORTS = 200
+
+var quorum_reports []string
+var quorum_mu sync.Mutex
+
+func Init_JSON_Clients() {
+
+	daemons = nil
+	for _, a := range SC_Config.Daemons {
+		if !strings.Contains(a, "://") {
+			a = "http://" + a
+		}
+		daemons = append(daemons, &Daemon{
+			Address: strings.TrimSuffix(a, "/") + "/json_rpc",
+			client:  &http.Client{Timeout: 30 * time.Second},
+		})
+	}
+}
+
+func (d *Daemon) Call(method string, params any, result any) error {
+
+	rateLimit.Wait()
+
+	data, err := json.Marshal(RPC_Request(method, params))
+	if err != nil {
+		return err
+	}
+	resp, err := d.client.Post(d.Address, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return xswd_response(b, result)
+}
+
+// ask the wallet's daemon and all configured daemons, the majority answer is used.
+// compare returns an empty string for matching answers, otherwise the difference
+func QuorumCall(method string, params any, result any, compare func(a, b json.RawMessage) string) error {
+
+	if len(daemons) == 0 {
+		return xswd.Call(method, params, result)
+	}
+
+	sources := []string{"wallet"}
+	answers := make([]json.RawMessage, len(daemons)+1)
+	errs := make([]error, len(daemons)+1)
+
+	var wg sync.WaitGroup
+	wg.Add(len(daemons) + 1)
+	go func() {
+		defer wg.Done()
+		errs[0] = xswd.Call(method, params, &answers[0])
+	}()
+	for i, d := range daemons {
+		sources = append(sources, d.Address)
+		go func() {
+			defer wg.Done()
+			errs[i+1] = d.Call(method, params, &answers[i+1])
+		}()
+	}
+	wg.Wait()
+
+	for i := range errs {
+		if errs[i] != nil {
+			log_xswd.Printf("%s: %s failed: %s", sources[i], method, errs[i])
+		}
+	}
+
+	majority, reports, err := QuorumVote(method, sources, answers, errs, SC_Config.Quorum, compare)
+	for _, r := range reports {
+		QuorumReport(r)
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(majority, result)
+}
+
+// group matching answers and pick the largest group, it needs quorum sources
+// (default: more than half). reports lists the sources that disagree with it
+func QuorumVote(method string, sources []string, answers []json.RawMessage, errs []error, quorum int, compare func(a, b json.RawMessage) string) (majority json.RawMessage, reports []string, err error) {
+
+	var groups [][]int
+	for i := range answers {
+		if errs[i] != nil {
+			continue
+		}
+		found := false
+		for g := range groups {
+			if compare(answers[groups[g][0]], answers[i]) == "" {
+				groups[g] = append(groups[g], i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			groups = append(groups, []int{i})
+		}
+	}
+	if len(groups) == 0 {
+		return nil, nil, errs[0]
+	}
+
+	best := 0
+	for g := range groups {
+		if len(groups[g]) > len(groups[best]) {
+			best = g
+		}
+	}
+	majority = answers[groups[best][0]]
+	for g := range groups {
+		if g == best {
+			continue
+		}
+		for _, i := range groups[g] {
+			reports = append(reports, fmt.Sprintf("%s: %s %s", sources[i], method, compare(majority, answers[i])))
+		}
+	}
+
+	if quorum < 1 {
+		quorum = len(sources)/2 + 1
+	}
+	if len(groups[best]) < quorum {
+		return nil, reports, fmt.Errorf("%s: no quorum, %d of %d sources agree", method, len(groups[best]), len(sources))
+	}
+
+	return majority, reports, nil
+}
+
+func QuorumReport(r string) {
+
+	log_xswd.Println("Daemons disagree:", r)
+
+	quorum_mu.Lock()
+	quorum_reports = append(quorum_reports, time.Now().Format(time.DateTime)+"  "+r)
+	if len(quorum_reports) > QUORUM_REPORTS {
+		quorum_reports = quorum_reports[len(quorum_reports)-QUORUM_REPORTS:]
+	}
+	quorum_mu.Unlock()
+}
+
+func QuorumReports() []string {
+
+	quorum_mu.Lock()
+	defer quorum_mu.Unlock()
+
+	return append([]string(nil), quorum_reports...)
+}
+
+func CompareSC(a, b json.RawMessage) string {
+
+	var x, y GetSC_Result
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return "invalid response"
+	}
+	if len(x.ValuesString) != len(y.ValuesString) {
+		return "missing SC values"
+	}
+	for i := range x.ValuesString {
+		if x.ValuesString[i] == y.ValuesString[i] {
+			continue
+		}
+		switch i {
+		case 0:
+			return fmt.Sprintf("height %s instead of %s", y.ValuesString[i], x.ValuesString[i])
+		case 1:
+			return fmt.Sprintf("diverging prev pointer %s instead of %s", y.ValuesString[i], x.ValuesString[i])
+		default:
+			mx, my := CountMessages(x.ValuesString[i]), CountMessages(y.ValuesString[i])
+			if my < mx {
+				return fmt.Sprintf("missing messages, %d instead of %d", my, mx)
+			}
+			return fmt.Sprintf("different messages, %d instead of %d", my, mx)
+		}
+	}
+
+	return ""
+}
+
+func CompareHeader(a, b json.RawMessage) string {
+
+	var x, y GetBlockHeader_Result
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return "invalid response"
+	}
+	if x.Block_Header.Hash != y.Block_Header.Hash {
+		return fmt.Sprintf("different block hash %s instead of %s", y.Block_Header.Hash, x.Block_Header.Hash)
+	}
+
+	return ""
+}
+
+func CountMessages(msg string) int {
+
+	plain, err := hex.DecodeString(msg)
+	if err != nil || len(plain) == 0 {
+		return 0
+	}
+
+	return len(GetMessages(string(plain)))
+}
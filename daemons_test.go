@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func header_answer(t *testing.T, hash string) json.RawMessage {
+
+	t.Helper()
+
+	var r GetBlockHeader_Result
+	r.Block_Header.Hash = hash
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestQuorumVote(t *testing.T) {
+
+	failed := errors.New("connection refused")
+
+	tests := []struct {
+		name    string
+		hashes  []string // answers of wallet, daemon 1, 2, ...; "" for a failed call
+		quorum  int
+		want    string
+		reports []string
+		invalid bool
+	}{
+		{name: "agree", hashes: []string{"a", "a", "a"}, want: "a"},
+		{name: "one disagrees", hashes: []string{"a", "b", "a"}, want: "a", reports: []string{"daemon1"}},
+		{name: "wallet disagrees", hashes: []string{"b", "a", "a"}, want: "a", reports: []string{"wallet"}},
+		{name: "no majority", hashes: []string{"a", "b", "c"}, reports: []string{"daemon1", "daemon2"}, invalid: true},
+		{name: "below quorum", hashes: []string{"a", "a", "b"}, quorum: 3, reports: []string{"daemon2"}, invalid: true},
+		{name: "one daemon erroring", hashes: []string{"a", "", "a"}, want: "a"},
+		// failed calls count as disagreeing sources
+		{name: "errors below quorum", hashes: []string{"a", "", ""}, invalid: true},
+		{name: "all erroring", hashes: []string{"", "", ""}, invalid: true},
+	}
+
+	for _, tt := range tests {
+		sources := make([]string, len(tt.hashes))
+		answers := make([]json.RawMessage, len(tt.hashes))
+		errs := make([]error, len(tt.hashes))
+		for i, h := range tt.hashes {
+			sources[i] = fmt.Sprintf("daemon%d", i)
+			if i == 0 {
+				sources[i] = "wallet"
+			}
+			if h == "" {
+				errs[i] = failed
+				continue
+			}
+			answers[i] = header_answer(t, h)
+		}
+
+		majority, reports, err := QuorumVote(DAEMON_BLOCK_HEADER_TOPO, sources, answers, errs, tt.quorum, CompareHeader)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("%s: accepted %s", tt.name, majority)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if CompareHeader(majority, header_answer(t, tt.want)) != "" {
+			t.Errorf("%s: majority %s, want %s", tt.name, majority, tt.want)
+		}
+
+		if len(reports) != len(tt.reports) {
+			t.Errorf("%s: reports %q, want %q", tt.name, reports, tt.reports)
+			continue
+		}
+		for i := range reports {
+			if !strings.HasPrefix(reports[i], tt.reports[i]+": ") || !strings.Contains(reports[i], "different block hash") {
+				t.Errorf("%s: report %q, want one of %s", tt.name, reports[i], tt.reports[i])
+			}
+		}
+	}
+}
+
+func TestCompareSC(t *testing.T) {
+
+	answer := func(values ...string) json.RawMessage {
+		data, _ := json.Marshal(GetSC_Result{ValuesString: values})
+		return data
+	}
+	msgs := func(n int) string {
+		m := make([]string, n)
+		for i := range m {
+			m[i] = "aa"
+		}
+		return fmt.Sprintf("%x", strings.Join(m, "+"))
+	}
+
+	tests := []struct {
+		a, b json.RawMessage
+		want string
+	}{
+		{answer("10", "5", msgs(2)), answer("10", "5", msgs(2)), ""},
+		{answer("10", "5", msgs(2)), answer("11", "5", msgs(2)), "height"},
+		{answer("10", "5", msgs(2)), answer("10", "4", msgs(2)), "diverging prev pointer"},
+		{answer("10", "5", msgs(2)), answer("10", "5", msgs(1)), "missing messages, 1 instead of 2"},
+		{answer("10", "5", msgs(2)), answer("10", "5"), "missing SC values"},
+	}
+	for _, tt := range tests {
+		got := CompareSC(tt.a, tt.b)
+		if tt.want == "" && got != "" || !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s / %s: %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestQuorumReportsCapped(t *testing.T) {
+
+	defer func(r []string) { quorum_reports = r }(quorum_reports)
+	quorum_reports = nil
+
+	for i := range QUORUM_REPORTS + 10 {
+		QuorumReport(fmt.Sprintf("report %d", i))
+	}
+
+	r := QuorumReports()
+	if len(r) != QUORUM_REPORTS || !strings.HasSuffix(r[len(r)-1], fmt.Sprintf("report %d", QUORUM_REPORTS+9)) || !strings.HasSuffix(r[0], "report 10") {
+		t.Errorf("%d reports, first %q", len(r), r[0])
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"sync"
+
+	"github.com/deroproject/derohe/cryptography/crypto"
+	"golang.org/x/crypto/argon2"
+)
+
+const DB_FILE = "dshout.db"
+const DB_MAGIC = "DSDB"
+
+const (
+	DB_KEY_WALLET     byte = 1
+	DB_KEY_PASSPHRASE byte = 2
+)
+
+// local message database, stored encrypted as a single file
+type Database struct {
+	Version   int                   `json:"version"`
+	Contracts map[string]*SyncState `json:"contracts"`
+	Messages  []MsgDecryped         `json:"messages"`
+	Sent      []MsgSent             `json:"sent"`
+	Outbox    []OutboxItem          `json:"outbox,omitempty"`
+	Contacts  map[string]string     `json:"contacts"`
+	Payload   uint64                `json:"payload_height,omitempty"`
+	Cover     uint64                `json:"cover_spent,omitempty"`
+	CoverSent int                   `json:"cover_sent,omitempty"`
+	Relay     []RelayItem           `json:"relay,omitempty"`
+
+	// single contract of version 1
+	SCID string     `json:"scid,omitempty"`
+	Sync *SyncState `json:"sync,omitempty"`
+}
+
+type SyncState struct {
+	LastUpdate uint64            `json:"last_update"`
+	LastPrev   uint64            `json:"last_prev"`
+	Hashes     map[uint64]string `json:"hashes,omitempty"`
+	Gap        *SyncGap          `json:"gap,omitempty"`
+}
+
+// migrations[i] upgrades a database from version i to i+1
+var migrations = []func(*Database) error{
+	MigrateLegacyFiles,
+	MigrateContracts,
+}
+
+var db_key [32]byte
+var db_salt []byte
+var db_mode byte
+var db_open bool
+
+// guards the state saved by DB_Save that the UI, the sync and the background
+// loops share: decrypted_messages, sent_messages, contacts, sync_states,
+// payload_height and the cover counters
+var db_mu sync.Mutex
+
+var contacts = map[string]string{}
+var legacy_files []string
+
+// open the database, an empty passphrase uses a key derived from the wallet key
+func DB_Open(passphrase string) error {
+
+	db_mode = DB_KEY_WALLET
+	if passphrase != "" {
+		db_mode = DB_KEY_PASSPHRASE
+	}
+
+	data, err := os.ReadFile(DB_FILE)
+	if errors.Is(err, os.ErrNotExist) {
+		db_salt = make([]byte, 16)
+		if _, err = rand.Read(db_salt); err != nil {
+			return err
+		}
+		db_key = DB_DeriveKey(passphrase, db_salt)
+		db_open = true
+
+		return DB_Apply(Database{SCID: SC_Config.Contracts[0].SCID})
+	} else if err != nil {
+		return err
+	}
+
+	if len(data) < len(DB_MAGIC)+17 || !bytes.Equal(data[:len(DB_MAGIC)], []byte(DB_MAGIC)) {
+		return fmt.Errorf("invalid database file")
+	}
+	data = data[len(DB_MAGIC):]
+	if data[0] != db_mode {
+		if data[0] == DB_KEY_PASSPHRASE {
+			return fmt.Errorf("database is protected by a passphrase")
+		}
+		return fmt.Errorf("database is protected by the wallet key")
+	}
+	db_salt = data[1:17]
+	db_key = DB_DeriveKey(passphrase, db_salt)
+
+	plain, err := DecryptMessageWithKey(db_key, data[17:])
+	if err != nil {
+		return fmt.Errorf("can't decrypt database, wrong key?")
+	}
+
+	var db Database
+	if err = json.Unmarshal(plain, &db); err != nil {
+		return err
+	}
+	if db.Version > len(migrations) {
+		return fmt.Errorf("database version %d is not supported", db.Version)
+	}
+	db_open = true
+
+	return DB_Apply(db)
+}
+
+func DB_DeriveKey(passphrase string, salt []byte) (key [32]byte) {
+
+	if passphrase == "" {
+		return sha256.Sum256(append([]byte("dShout database"), crypto.ConvertBigIntToByte(privateKey)...))
+	}
+	copy(key[:], argon2.IDKey([]byte(passphrase), salt, 3, 64*1024, 4, 32))
+
+	return
+}
+
+// run pending migrations and load the database into memory
+func DB_Apply(db Database) error {
+
+	migrated := false
+	for db.Version < len(migrations) {
+		if err := migrations[db.Version](&db); err != nil {
+			return fmt.Errorf("migration to version %d failed: %s", db.Version+1, err)
+		}
+		db.Version++
+		migrated = true
+	}
+
+	db_mu.Lock()
+	sync_states = db.Contracts
+	if sync_states == nil {
+		sync_states = map[string]*SyncState{}
+	}
+	decrypted_messages = db.Messages
+	sent_messages = db.Sent
+	payload_height = db.Payload
+	cover_spent, cover_sent = db.Cover, db.CoverSent
+	if db.Contacts != nil {
+		contacts = db.Contacts
+	}
+	db_mu.Unlock()
+
+	sc_active = ""
+	SC_Select(SC_Config.Contracts[0].SCID)
+	outbox = db.Outbox
+	relay_items = db.Relay
+	for i := range outbox {
+		// interrupted while waiting for the wallet, may have been sent.
+		// Entries of older releases have no height to look them up from
+		if outbox[i].State == OUTBOX_SENDING {
+			outbox[i].State = OUTBOX_UNKNOWN
+			outbox[i].Error = "interrupted, looking for it on chain before a retry"
+			if outbox[i].Since == 0 {
+				outbox[i].State = OUTBOX_FAILED
+				outbox[i].Error = "interrupted, check sent messages before retrying"
+			}
+		}
+	}
+
+	if migrated {
+		if err := DB_Save(); err != nil {
+			return err
+		}
+		// imported files aren't needed anymore
+		for _, f := range legacy_files {
+			os.Remove(f)
+		}
+		legacy_files = nil
+	}
+
+	return nil
+}
+
+func DB_Save() error {
+
+	db_mu.Lock()
+	defer db_mu.Unlock()
+
+	return db_write(db_state())
+}
+
+// the state DB_Save writes, db_mu has to be held
+func db_state() Database {
+	return Database{
+		Version:   len(migrations),
+		Contracts: sync_states,
+		Messages:  decrypted_messages,
+		Sent:      sent_messages,
+		Outbox:    OutboxItems(),
+		Contacts:  contacts,
+		Payload:   payload_height,
+		Cover:     cover_spent,
+		CoverSent: cover_sent,
+		Relay:     RelayItems(),
+	}
+}
+
+// encrypt and write the database, db_mu has to be held
+func db_write(db Database) error {
+
+	if !db_open {
+		return fmt.Errorf("database is locked")
+	}
+
+	plain, err := json.Marshal(db)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := EncryptMessageWithKey(db_key, plain)
+	if err != nil {
+		return err
+	}
+
+	data := append([]byte(DB_MAGIC), db_mode)
+	data = append(data, db_salt...)
+	data = append(data, encrypted...)
+
+	// write a temporary file first, a crash must not corrupt the database
+	if err = os.WriteFile(DB_FILE+".tmp", data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(DB_FILE+".tmp", DB_FILE)
+}
+
+// version 1: import the plain text files of older releases
+func MigrateLegacyFiles(db *Database) error {
+
+	if data, err := os.ReadFile(CHECKPOINT_FILE); err == nil {
+		var cp Checkpoint
+		if err = json.Unmarshal(data, &cp); err != nil {
+			return err
+		}
+		if cp.SCID == db.SCID {
+			db.Sync = &SyncState{LastUpdate: cp.LastUpdate, LastPrev: cp.Prev}
+			db.Messages = cp.Messages
+		}
+		legacy_files = append(legacy_files, CHECKPOINT_FILE)
+	}
+	if data, err := os.ReadFile(SENT_FILE); err == nil {
+		if err = json.Unmarshal(data, &db.Sent); err != nil {
+			return err
+		}
+		legacy_files = append(legacy_files, SENT_FILE)
+	}
+
+	return nil
+}
+
+// version 2: sync state per contract, messages labeled by contract
+func MigrateContracts(db *Database) error {
+
+	db.Contracts = map[string]*SyncState{}
+	if db.SCID != "" {
+		if db.Sync != nil {
+			db.Contracts[db.SCID] = db.Sync
+		}
+		for i := range db.Messages {
+			db.Messages[i].SCID = db.SCID
+		}
+		for i := range db.Sent {
+			db.Sent[i].SCID = db.SCID
+		}
+	}
+	db.SCID = ""
+	db.Sync = nil
+
+	return nil
+}
+
+func AddContact(name string, address string) error {
+
+	if name == "" || IsChannel(name) {
+		return fmt.Errorf("invalid contact name")
+	}
+	r := ValidateReceivers([]string{address})
+	if len(r) != 1 || IsChannel(r[0]) {
+		return fmt.Errorf("invalid address")
+	}
+	db_mu.Lock()
+	contacts[name] = r[0]
+	db_mu.Unlock()
+
+	return DB_Save()
+}
+
+func RemoveContact(name string) error {
+
+	db_mu.Lock()
+	delete(contacts, name)
+	db_mu.Unlock()
+
+	return DB_Save()
+}
+
+// address of a contact name
+func ContactAddress(name string) (string, bool) {
+
+	db_mu.Lock()
+	defer db_mu.Unlock()
+
+	addr, ok := contacts[name]
+
+	return addr, ok
+}
+
+// copy of the contacts
+func Contacts() map[string]string {
+
+	db_mu.Lock()
+	defer db_mu.Unlock()
+
+	return maps.Clone(contacts)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/deroproject/derohe/cryptography/crypto"
+)
+
+func TestMigrateLegacyFiles(t *testing.T) {
+
+	test_db(t)
+
+	cp, _ := json.Marshal(Checkpoint{SCID: TEST_SCID_A, LastUpdate: 120, Prev: 100, Messages: []MsgDecryped{{Message: "old message", Block: 100}}})
+	sent, _ := json.Marshal([]MsgSent{{TXID: "txid", Status: "confirmed"}})
+	if err := os.WriteFile(CHECKPOINT_FILE, cp, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(SENT_FILE, sent, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// a database of an older release, upgraded to the current version
+	if err := DB_Apply(Database{SCID: TEST_SCID_A}); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := sync_states[TEST_SCID_A]; s == nil || s.LastUpdate != 120 || s.LastPrev != 100 {
+		t.Errorf("sync state %+v", s)
+	}
+	if len(decrypted_messages) != 1 || decrypted_messages[0].Message != "old message" || decrypted_messages[0].SCID != TEST_SCID_A {
+		t.Errorf("messages %+v", decrypted_messages)
+	}
+	if len(sent_messages) != 1 || sent_messages[0].TXID != "txid" || sent_messages[0].SCID != TEST_SCID_A {
+		t.Errorf("sent messages %+v", sent_messages)
+	}
+
+	// imported into the saved database, the files are removed
+	for _, f := range []string{CHECKPOINT_FILE, SENT_FILE} {
+		if _, err := os.Stat(f); !os.IsNotExist(err) {
+			t.Errorf("%s not removed", f)
+		}
+	}
+	db_open = false
+	if err := DB_Open(""); err != nil {
+		t.Fatal(err)
+	}
+	if len(decrypted_messages) != 1 || len(sent_messages) != 1 {
+		t.Errorf("migrated database not saved: %d messages, %d sent", len(decrypted_messages), len(sent_messages))
+	}
+}
+
+func TestMigrateContracts(t *testing.T) {
+
+	db := Database{
+		Version:  1,
+		SCID:     TEST_SCID_A,
+		Sync:     &SyncState{LastUpdate: 50},
+		Messages: []MsgDecryped{{Message: "a"}, {Message: "b"}},
+		Sent:     []MsgSent{{TXID: "txid"}},
+	}
+	if err := MigrateContracts(&db); err != nil {
+		t.Fatal(err)
+	}
+
+	if db.SCID != "" || db.Sync != nil {
+		t.Errorf("single contract fields kept: %q %+v", db.SCID, db.Sync)
+	}
+	if s := db.Contracts[TEST_SCID_A]; s == nil || s.LastUpdate != 50 {
+		t.Errorf("sync state %+v", db.Contracts)
+	}
+	for _, m := range db.Messages {
+		if m.SCID != TEST_SCID_A {
+			t.Errorf("message %+v not labeled", m)
+		}
+	}
+	if db.Sent[0].SCID != TEST_SCID_A {
+		t.Errorf("sent message %+v not labeled", db.Sent[0])
+	}
+
+	// a database that never synced
+	empty := Database{Version: 1}
+	if err := MigrateContracts(&empty); err != nil || empty.Contracts == nil || len(empty.Contracts) != 0 {
+		t.Errorf("empty database: %+v, %v", empty.Contracts, err)
+	}
+}
+
+func TestDBOpen(t *testing.T) {
+
+	test_db(t)
+
+	address := test_address(t, crypto.RandomScalar())
+	if err := AddContact("alice", address); err != nil {
+		t.Fatal(err)
+	}
+
+	db_open = false
+	contacts = map[string]string{}
+	if err := DB_Open("secret"); err == nil {
+		t.Error("database of the wallet key opened with a passphrase")
+	}
+	if err := DB_Open(""); err != nil {
+		t.Fatal(err)
+	}
+	if a, ok := ContactAddress("alice"); !ok || a != address {
+		t.Errorf("contact not restored: %q", a)
+	}
+
+	// written by a newer release
+	plain, _ := json.Marshal(Database{Version: len(migrations) + 1})
+	encrypted, err := EncryptMessageWithKey(db_key, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append([]byte(DB_MAGIC), db_mode)
+	data = append(data, db_salt...)
+	if err := os.WriteFile(DB_FILE, append(data, encrypted...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := DB_Open(""); err == nil {
+		t.Error("unsupported version opened")
+	}
+}
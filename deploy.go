@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Store contract as shown in the README
+//
+//go:embed store.bas
+var store_code string
+
+// the installation needs a known signer, the SCID is the TXID
+func SC_Deploy() (scid string, err error) {
+
+	var a GetAddress_Result
+	if err = xswd.Call(WALLET_GET_ADDRESS, nil, &a); err != nil {
+		return "", err
+	}
+
+	t := Transfer_Params{
+		SC_Code:  store_code,
+		Ringsize: 2,
+		Signer:   a.Address,
+	}
+	t.Transfers = append(t.Transfers, BuildTransfer())
+
+	log_xswd.Println(">", DAEMON_GAS_ESTIMATE)
+	var r GasEstimate_Result
+	if err = xswd.Call(DAEMON_GAS_ESTIMATE, t, &r); err != nil {
+		return "", err
+	}
+	f, err := EstimateFees(t, r)
+	if err != nil {
+		return "", err
+	}
+	t.Fees = f.Total
+
+	if scid, err = SC_Transfer(t); err == nil && scid == "" {
+		err = fmt.Errorf("empty TXID")
+	}
+
+	return scid, err
+}
+
+// wait until Initialize ran
+func SC_WaitDeployed(ctx context.Context, scid string) error {
+
+	for {
+		r, err := SC_GetSnapshot(scid, 0)
+		if err == nil && len(r.ValuesString) > 0 {
+			if h, err := strconv.ParseUint(r.ValuesString[0], 10, 64); err == nil && h > 0 {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(BLOCK_TIME):
+		}
+	}
+}
+
+// deploy a new contract and add it to the config
+func SC_DeployContract(ctx context.Context, name string) (scid string, err error) {
+
+	if name == "" {
+		return "", fmt.Errorf("empty contract name")
+	}
+	if _, ok := GetContractByName(name); ok {
+		return "", fmt.Errorf("contract %s already exists", name)
+	}
+
+	if scid, err = SC_Deploy(); err != nil {
+		return "", err
+	}
+	log_xswd.Println("Contract deployed, waiting for SCID", scid)
+
+	if err = SC_WaitDeployed(ctx, scid); err != nil {
+		return scid, err
+	}
+
+	return scid, AddContract(name, scid)
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+
+	"github.com/deroproject/derohe/cryptography/bn256"
+	"github.com/deroproject/derohe/cryptography/crypto"
+	"github.com/deroproject/derohe/globals"
+	"github.com/deroproject/derohe/rpc"
+)
+
+// proof that a message was stored on chain and addressed to the receiver
+type Disclosure struct {
+	SCID      string `json:"scid"`
+	Height    uint64 `json:"height"`
+	TXID      string `json:"txid,omitempty"`
+	Envelope  string `json:"envelope"`
+	Receiver  string `json:"receiver"`
+	Index     int    `json:"index"`
+	DH        string `json:"dh"`
+	Key       string `json:"key"`
+	PQShared  string `json:"pq_shared,omitempty"`
+	Challenge string `json:"challenge"`
+	Response  string `json:"response"`
+}
+
+// reveal the DH point of one commitment and prove it was derived with the receiver's private key
+func CreateDisclosure(m MsgDecryped) (d Disclosure, err error) {
+
+	if m.Envelope == "" {
+		return d, fmt.Errorf("no envelope for this message")
+	}
+
+	key := privateKey
+	if m.Channel != "" {
+		key = ChannelKey(m.Channel)
+		d.Receiver = CHANNEL_PREFIX + m.Channel
+	} else {
+		pub := new(bn256.G1).ScalarMult(crypto.G, key)
+		addr, err := rpc.NewAddressFromCompressedKeys(pub.EncodeCompressed())
+		if err != nil {
+			return d, err
+		}
+		d.Receiver = addr.String()
+	}
+
+	pub_bytes, commits := GetCommitments(m.Envelope)
+	if m.Index < 0 || m.Index >= len(commits) {
+		return d, fmt.Errorf("invalid commitment index")
+	}
+	r_pub, err := bn256.Decompress(pub_bytes)
+	if err != nil {
+		return d, err
+	}
+	dh := new(bn256.G1).ScalarMult(r_pub, key)
+
+	shared_keys, err := GetSharedKeys(pub_bytes, commits, key)
+	if err != nil {
+		return d, err
+	}
+	msg_key := shared_keys[m.Index]
+
+	pq, _ := GetPQ(GetPayload(m.Envelope))
+	if pq != nil {
+		dk, err := MLKEMKey()
+		if err != nil {
+			return d, err
+		}
+		shared, err := dk.Decapsulate(pq[m.Index][:PQ_ENTRY_SIZE-32])
+		if err != nil {
+			return d, err
+		}
+		d.PQShared = hex.EncodeToString(shared)
+		if msg_key, err = HybridUnwrap(msg_key, pq[m.Index]); err != nil {
+			return d, err
+		}
+	}
+
+	d.SCID = m.SCID
+	d.Height = m.Block
+	d.TXID = m.TXID
+	d.Envelope = m.Envelope
+	d.Index = m.Index
+	d.DH = hex.EncodeToString(dh.EncodeCompressed())
+	d.Key = hex.EncodeToString(msg_key[:])
+
+	// the proof is bound to everything it discloses, it can't be moved to another envelope
+	c, s := DLEQProve(key, r_pub, DisclosureContext(d))
+	d.Challenge = hex.EncodeToString(crypto.ConvertBigIntToByte(c))
+	d.Response = hex.EncodeToString(crypto.ConvertBigIntToByte(s))
+
+	return d, nil
+}
+
+func ExportDisclosure(m MsgDecryped) ([]byte, error) {
+
+	d, err := CreateDisclosure(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(d, "", "\t")
+}
+
+// data of a disclosure the proof commits to
+func DisclosureContext(d Disclosure) []byte {
+
+	envelope := sha256.Sum256([]byte(d.Envelope))
+
+	return fmt.Appendf(nil, "%s|%d|%s|%s|%d|%x|%s", d.SCID, d.Height, d.TXID, d.Receiver, d.Index, envelope, d.PQShared)
+}
+
+// Chaum-Pedersen proof for log_G(P) == log_R(D), context is hashed into the challenge
+func DLEQProve(x *big.Int, r_pub *bn256.G1, context []byte) (c *big.Int, s *big.Int) {
+
+	p := new(bn256.G1).ScalarMult(crypto.G, x)
+	d := new(bn256.G1).ScalarMult(r_pub, x)
+
+	k := crypto.RandomScalar()
+	a1 := new(bn256.G1).ScalarMult(crypto.G, k)
+	a2 := new(bn256.G1).ScalarMult(r_pub, k)
+
+	c = DLEQChallenge(context, p, r_pub, d, a1, a2)
+	s = new(big.Int).Mod(new(big.Int).Add(k, new(big.Int).Mul(c, x)), bn256.Order)
+
+	return
+}
+
+func DLEQVerify(p *bn256.G1, r_pub *bn256.G1, d *bn256.G1, c *big.Int, s *big.Int, context []byte) bool {
+
+	// a1 = s*G - c*P, a2 = s*R - c*D
+	a1 := new(bn256.G1).Add(new(bn256.G1).ScalarMult(crypto.G, s), new(bn256.G1).Neg(new(bn256.G1).ScalarMult(p, c)))
+	a2 := new(bn256.G1).Add(new(bn256.G1).ScalarMult(r_pub, s), new(bn256.G1).Neg(new(bn256.G1).ScalarMult(d, c)))
+
+	return DLEQChallenge(context, p, r_pub, d, a1, a2).Cmp(c) == 0
+}
+
+func DLEQChallenge(context []byte, points ...*bn256.G1) *big.Int {
+
+	data := []byte("dShout disclosure")
+	context_hash := sha256.Sum256(context)
+	data = append(data, context_hash[:]...)
+	data = append(data, crypto.G.EncodeCompressed()...)
+	for _, p := range points {
+		data = append(data, p.EncodeCompressed()...)
+	}
+
+	return crypto.ReducedHash(data)
+}
+
+// check a disclosure without the receiver's private key, returns the message
+func VerifyDisclosure(d Disclosure) (content string, err error) {
+
+	if _, ok := GetContract(d.SCID); !ok {
+		return "", fmt.Errorf("disclosure is for unknown SCID %s", d.SCID)
+	}
+	if err = SC_VerifyCode(d.SCID); err != nil {
+		return "", err
+	}
+
+	if content, err = VerifyDisclosureProof(d); err != nil {
+		return "", err
+	}
+
+	// envelope must be part of the SC history
+	r, err := SC_GetSnapshotAtHeight(d.SCID, d.Height)
+	if err != nil {
+		return "", err
+	}
+	if !SC_SanityCheck(r) {
+		return "", fmt.Errorf("SC sanity check failed")
+	}
+	if r.ValuesString[0] != fmt.Sprintf("%d", d.Height) {
+		return "", fmt.Errorf("no SC data stored at height %d", d.Height)
+	}
+	plain, err := hex.DecodeString(r.ValuesString[2])
+	if err != nil {
+		return "", err
+	}
+	if !slices.Contains(GetMessages(string(plain)), d.Envelope) {
+		return "", fmt.Errorf("envelope not found at height %d", d.Height)
+	}
+	if d.PQShared != "" {
+		log_xswd.Println("Hybrid envelope: the ML-KEM share isn't proven, it only opens the message")
+	}
+
+	return content, nil
+}
+
+// checks of a disclosure that don't need the chain: key derivation proof and decryption.
+// The ML-KEM share of a hybrid envelope can't be proven without the receiver's
+// decapsulation key, it's only confirmed by opening the message
+func VerifyDisclosureProof(d Disclosure) (content string, err error) {
+
+	if !SanityCheck(d.Envelope) {
+		return "", fmt.Errorf("invalid envelope")
+	}
+
+	// receiver public key
+	var p *bn256.G1
+	if IsChannel(d.Receiver) {
+		p = new(bn256.G1).ScalarMult(crypto.G, ChannelKey(d.Receiver))
+	} else {
+		addr, err := globals.ParseValidateAddress(d.Receiver)
+		if err != nil {
+			return "", err
+		}
+		if p, err = bn256.Decompress(addr.PublicKey.EncodeCompressed()); err != nil {
+			return "", err
+		}
+	}
+
+	pub_bytes, commits := GetCommitments(d.Envelope)
+	if d.Index < 0 || d.Index >= len(commits) {
+		return "", fmt.Errorf("invalid commitment index")
+	}
+	r_pub, _ := bn256.Decompress(pub_bytes)
+	commit, _ := bn256.Decompress(commits[d.Index])
+
+	dh, err := DecodePoint(d.DH)
+	if err != nil {
+		return "", err
+	}
+	c, err := hex.DecodeString(d.Challenge)
+	if err != nil {
+		return "", err
+	}
+	s, err := hex.DecodeString(d.Response)
+	if err != nil {
+		return "", err
+	}
+	if !DLEQVerify(p, r_pub, dh, new(big.Int).SetBytes(c), new(big.Int).SetBytes(s), DisclosureContext(d)) {
+		return "", fmt.Errorf("invalid proof of key derivation")
+	}
+
+	// derive the message key from the revealed DH point
+	shared := new(bn256.G1).Add(commit, new(bn256.G1).Neg(dh))
+	key := sha256.Sum256(shared.EncodeCompressed())
+
+	pq, payload := GetPQ(GetPayload(d.Envelope))
+	if pq != nil {
+		if d.Index >= len(pq) {
+			return "", fmt.Errorf("missing ML-KEM entry")
+		}
+		pq_shared, err := hex.DecodeString(d.PQShared)
+		if err != nil {
+			return "", err
+		}
+		var wrap [32]byte
+		copy(wrap[:], pq[d.Index][PQ_ENTRY_SIZE-32:])
+		key = HybridKey(key, PQWrap(wrap, pq_shared))
+	}
+	if hex.EncodeToString(key[:]) != d.Key {
+		return "", fmt.Errorf("message key doesn't match")
+	}
+
+	msg_hex, err := PayloadCheck(payload)
+	if err != nil {
+		return "", err
+	}
+	decrypted, err := DecryptMessageWithKey(key, msg_hex)
+	if err != nil || !HasIdentifier(string(decrypted)) {
+		return "", fmt.Errorf("decryption failed")
+	}
+
+	_, content = GetTTL(string(decrypted))
+
+	return content, nil
+}
+
+func VerifyDisclosureFile(file string) (content string, err error) {
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	var d Disclosure
+	if err = json.Unmarshal(data, &d); err != nil {
+		return "", err
+	}
+
+	return VerifyDisclosure(d)
+}
+
+func DecodePoint(s string) (*bn256.G1, error) {
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return bn256.Decompress(b)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// disclosure of the first message of the envelope addressed to us
+func test_disclosure(t *testing.T, envelope string) Disclosure {
+
+	t.Helper()
+
+	m := DecryptMessages(envelope)
+	if len(m) != 1 {
+		t.Fatalf("got %d messages, want 1", len(m))
+	}
+	m[0].SCID = "a8ee7e571130342e0b7baa9052ccbfe3c1766cc454403721d2a357e7eda14894"
+	m[0].Block = 12345
+
+	d, err := CreateDisclosure(m[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return d
+}
+
+func TestDisclosureProof(t *testing.T) {
+
+	me := test_identity(t)
+	envelope, _ := test_envelope(t, "disclosed message", false, me)
+
+	d := test_disclosure(t, envelope)
+	if d.Receiver != me {
+		t.Errorf("receiver %s, want %s", d.Receiver, me)
+	}
+	content, err := VerifyDisclosureProof(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(content, "disclosed message") {
+		t.Errorf("content %q", content)
+	}
+}
+
+func TestDisclosureBinding(t *testing.T) {
+
+	me := test_identity(t)
+	envelope, _ := test_envelope(t, "disclosed message", false, me)
+	other, _ := test_envelope(t, "another message", false, me)
+	d := test_disclosure(t, envelope)
+	o := test_disclosure(t, other)
+
+	tests := []struct {
+		name   string
+		modify func(d *Disclosure)
+	}{
+		{"height", func(d *Disclosure) { d.Height++ }},
+		{"scid", func(d *Disclosure) { d.SCID = strings.Repeat("0", 64) }},
+		{"txid", func(d *Disclosure) { d.TXID = strings.Repeat("1", 64) }},
+		{"key", func(d *Disclosure) { d.Key = strings.Repeat("0", 64) }},
+		// proof of one envelope presented with another one
+		{"replay", func(d *Disclosure) { d.Envelope, d.DH, d.Key = o.Envelope, o.DH, o.Key }},
+	}
+	for _, tt := range tests {
+		changed := d
+		tt.modify(&changed)
+		if _, err := VerifyDisclosureProof(changed); err == nil {
+			t.Errorf("%s: modified disclosure accepted", tt.name)
+		}
+	}
+}
+
+func TestDisclosureChannel(t *testing.T) {
+
+	test_identity(t)
+	defer func(c []string) { SC_Config.Channels = c }(SC_Config.Channels)
+	SC_Config.Channels = []string{"dero"}
+
+	envelope, _ := test_envelope(t, "channel message", false, "#dero")
+	d := test_disclosure(t, envelope)
+	if !IsChannel(d.Receiver) {
+		t.Fatalf("receiver %s is no channel", d.Receiver)
+	}
+	if _, err := VerifyDisclosureProof(d); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDisclosureHybrid(t *testing.T) {
+
+	me := test_identity(t)
+	envelope, _ := test_envelope(t, "hybrid disclosed message", true, me)
+
+	d := test_disclosure(t, envelope)
+	if d.PQShared == "" {
+		t.Fatal("no ML-KEM share disclosed")
+	}
+	if _, err := VerifyDisclosureProof(d); err != nil {
+		t.Fatal(err)
+	}
+
+	// a wrong share doesn't open the message and isn't covered by the proof
+	b, _ := hex.DecodeString(d.PQShared)
+	b[0] ^= 1
+	d.PQShared = hex.EncodeToString(b)
+	if _, err := VerifyDisclosureProof(d); err == nil {
+		t.Error("wrong ML-KEM share accepted")
+	}
+}
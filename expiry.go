@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const TTL_PREFIX = "<TTL "
+const TTL_SUFFIX = ">\n"
+const BLOCK_TIME = 18 * time.Second
+
+// time to live, either in blocks or wall time
+type TTL struct {
+	Blocks   uint64
+	Duration time.Duration
+}
+
+// "100b" means 100 blocks, everything else is a duration like "2h" or "30m"
+func ParseTTL(s string) (t TTL, err error) {
+
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return t, nil
+	}
+
+	if strings.HasSuffix(s, "b") {
+		if t.Blocks, err = strconv.ParseUint(strings.TrimSuffix(s, "b"), 10, 64); err != nil || t.Blocks == 0 {
+			return t, fmt.Errorf("invalid TTL: %s", s)
+		}
+		return t, nil
+	}
+
+	if t.Duration, err = time.ParseDuration(s); err != nil || t.Duration <= 0 {
+		return t, fmt.Errorf("invalid TTL: %s", s)
+	}
+
+	return t, nil
+}
+
+func (t TTL) IsZero() bool {
+	return t.Blocks == 0 && t.Duration == 0
+}
+
+func (t TTL) String() string {
+	if t.Blocks > 0 {
+		return fmt.Sprintf("%db", t.Blocks)
+	}
+	return fmt.Sprintf("%ds", int64(t.Duration.Seconds()))
+}
+
+// put TTL header in front of the message, an existing header gets replaced
+func AddTTL(msg string, t TTL) string {
+
+	_, msg = GetTTL(msg)
+	if t.IsZero() {
+		return msg
+	}
+
+	return TTL_PREFIX + t.String() + TTL_SUFFIX + msg
+}
+
+// split TTL header and message
+func GetTTL(msg string) (t TTL, content string) {
+
+	if !strings.HasPrefix(msg, TTL_PREFIX) {
+		return t, msg
+	}
+	end := strings.Index(msg, TTL_SUFFIX)
+	if end < 0 {
+		return t, msg
+	}
+
+	t, err := ParseTTL(msg[len(TTL_PREFIX):end])
+	if err != nil {
+		return TTL{}, msg
+	}
+
+	return t, msg[end+len(TTL_SUFFIX):]
+}
+
+// calculate expiry from block height and block time
+func SetExpiry(m *MsgDecryped, block_time time.Time) {
+
+	m.TTL, m.Message = GetTTL(m.Message)
+
+	if m.TTL.Blocks > 0 {
+		m.ExpireHeight = m.Block + m.TTL.Blocks
+	}
+	if m.TTL.Duration > 0 {
+		if block_time.IsZero() {
+			block_time = time.Now()
+		}
+		m.ExpireTime = block_time.Add(m.TTL.Duration)
+	}
+}
+
+func (m MsgDecryped) Expired() bool {
+
+	if m.ExpireHeight > 0 && chain_height.Load() >= m.ExpireHeight {
+		return true
+	}
+	if !m.ExpireTime.IsZero() && time.Now().After(m.ExpireTime) {
+		return true
+	}
+
+	return false
+}
+
+// remaining lifetime, empty for messages without TTL
+func (m MsgDecryped) Countdown() string {
+
+	if m.Expired() {
+		return "expired"
+	}
+	if m.ExpireHeight > 0 {
+		blocks := m.ExpireHeight - chain_height.Load()
+		return fmt.Sprintf("expires in %d blocks (~%v)", blocks, time.Duration(blocks)*BLOCK_TIME)
+	}
+	if !m.ExpireTime.IsZero() {
+		return fmt.Sprintf("expires in %v", time.Until(m.ExpireTime).Round(time.Second))
+	}
+
+	return ""
+}
+
+// current and stable height, used for block based TTLs
+func RefreshHeight() error {
+
+	h, err := GetHeight()
+	if err != nil {
+		return err
+	}
+	chain_height.Store(h.Height)
+	stable_height.Store(uint64(h.StableHeight))
+
+	return nil
+}
+
+// remove expired messages from the local store
+func PurgeExpired() (count int) {
+
+	db_mu.Lock()
+	defer db_mu.Unlock()
+
+	var messages []MsgDecryped
+	for _, m := range decrypted_messages {
+		if m.Expired() {
+			count++
+			continue
+		}
+		messages = append(messages, m)
+	}
+	decrypted_messages = messages
+
+	return
+}
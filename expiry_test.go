@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTTL(t *testing.T) {
+
+	tests := []struct {
+		in      string
+		want    TTL
+		invalid bool
+	}{
+		{in: "", want: TTL{}},
+		{in: "100b", want: TTL{Blocks: 100}},
+		{in: " 2h ", want: TTL{Duration: 2 * time.Hour}},
+		{in: "30m", want: TTL{Duration: 30 * time.Minute}},
+		{in: "0b", invalid: true},
+		{in: "-5m", invalid: true},
+		{in: "xb", invalid: true},
+		{in: "tomorrow", invalid: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseTTL(tt.in)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("ParseTTL(%q) accepted", tt.in)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseTTL(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestTTLHeader(t *testing.T) {
+
+	for _, ttl := range []TTL{{Blocks: 100}, {Duration: 90 * time.Minute}} {
+		msg := AddTTL("hello world", ttl)
+		got, content := GetTTL(msg)
+		if got != ttl || content != "hello world" {
+			t.Errorf("GetTTL(AddTTL(%v)) = %v, %q", ttl, got, content)
+		}
+		// an existing header gets replaced
+		if again := AddTTL(msg, ttl); again != msg {
+			t.Errorf("AddTTL twice = %q, want %q", again, msg)
+		}
+	}
+
+	if msg := AddTTL("hello world", TTL{}); msg != "hello world" {
+		t.Errorf("AddTTL without TTL = %q", msg)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+
+	defer chain_height.Store(chain_height.Load())
+	chain_height.Store(1000)
+
+	m := MsgDecryped{Message: AddTTL("hello", TTL{Blocks: 10}), Block: 995}
+	SetExpiry(&m, time.Time{})
+	if m.ExpireHeight != 1005 || m.Message != "hello" {
+		t.Fatalf("SetExpiry: height %d, message %q", m.ExpireHeight, m.Message)
+	}
+	if m.Expired() {
+		t.Error("expired before its height")
+	}
+	if c := m.Countdown(); c != "expires in 5 blocks (~1m30s)" {
+		t.Errorf("Countdown() = %q", c)
+	}
+	chain_height.Store(1005)
+	if !m.Expired() {
+		t.Error("not expired at its height")
+	}
+
+	m = MsgDecryped{Message: AddTTL("hello", TTL{Duration: time.Hour})}
+	SetExpiry(&m, time.Now().Add(-2*time.Hour))
+	if !m.Expired() {
+		t.Error("duration TTL not expired")
+	}
+
+	m = MsgDecryped{Message: "hello"}
+	SetExpiry(&m, time.Now())
+	if m.Expired() || m.Countdown() != "" {
+		t.Error("message without TTL expires")
+	}
+}
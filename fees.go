@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/deroproject/derohe/config"
+	"github.com/deroproject/derohe/rpc"
+)
+
+type FeeBreakdown struct {
+	SCData     uint64 // serialized SC arguments in bytes
+	Network    uint64
+	GasStorage uint64
+	GasCompute uint64
+	Total      uint64
+}
+
+func (f FeeBreakdown) String() string {
+	return fmt.Sprintf("SC data: %d bytes\nNetwork fee: %s DERO\nStorage gas: %s DERO\nCompute gas: %s DERO\nTotal: %s DERO",
+		f.SCData, FormatDERO(f.Network), FormatDERO(f.GasStorage), FormatDERO(f.GasCompute), FormatDERO(f.Total))
+}
+
+func FormatDERO(atomic uint64) string {
+	return fmt.Sprintf("%d.%05d", atomic/100000, atomic%100000)
+}
+
+// SC arguments as the wallet serializes them into the transaction,
+// including the install arguments it adds for SC_Code
+func SCArguments(t Transfer_Params) (rpc.Arguments, error) {
+
+	var args rpc.Arguments
+	b, err := json.Marshal(t.SC_RPC)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(b, &args); err != nil {
+		return nil, err
+	}
+
+	if t.SC_Code != "" && t.SC_ID == "" {
+		args = append(args,
+			rpc.Argument{Name: rpc.SCACTION, DataType: rpc.DataUint64, Value: uint64(rpc.SC_INSTALL)},
+			rpc.Argument{Name: rpc.SCCODE, DataType: rpc.DataString, Value: t.SC_Code})
+	}
+
+	return args, nil
+}
+
+// serialized size of the SC arguments, they are charged by the wallet and as storage gas
+func SCDataSize(t Transfer_Params) (int, error) {
+
+	args, err := SCArguments(t)
+	if err != nil || len(args) == 0 {
+		return 0, err
+	}
+	data, err := args.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// fee the wallet charges when none is given, see BuildTransaction in
+// walletapi/transaction_build.go: a share per transfer and ring size plus
+// 1.5 atomic units per byte of SC data
+func NetworkFee(transfers int, ringsize uint64, sc_data int) uint64 {
+
+	fees := uint64(transfers+2) * uint64(float64(config.FEE_PER_KB)*(float64(ringsize/16)+1))
+
+	return fees + uint64(sc_data)*15/10
+}
+
+func EstimateFees(t Transfer_Params, gas GasEstimate_Result) (f FeeBreakdown, err error) {
+
+	size, err := SCDataSize(t)
+	if err != nil {
+		return f, err
+	}
+	f.SCData = uint64(size)
+	f.Network = NetworkFee(len(t.Transfers), t.Ringsize, int(f.SCData))
+
+	f.GasStorage = gas.GasStorage
+	f.GasCompute = gas.GasCompute
+	f.Total = f.Network + f.GasStorage + f.GasCompute
+
+	if SC_Config.MaxFee > 0 && f.Total > SC_Config.MaxFee {
+		return f, fmt.Errorf("fee of %s DERO exceeds the maximum of %s DERO", FormatDERO(f.Total), FormatDERO(SC_Config.MaxFee))
+	}
+
+	return f, nil
+}
+
+// everything the user confirms before a message is sent
+type SendPreview struct {
+	Size      int // ciphertext bytes
+	Receivers int
+	Ringsize  uint64
+	Fees      FeeBreakdown
+	Balance   uint64
+}
+
+func NewSendPreview(msg string, t Transfer_Params, f FeeBreakdown) (p SendPreview, err error) {
+
+	var b GetBalance_Result
+	if err = xswd.Call(WALLET_GET_BALANCE, nil, &b); err != nil {
+		return p, err
+	}
+
+	// payload messages are plain text with one transfer per receiver
+	size, receivers := len(msg), len(t.Transfers)
+	if t.SC_RPC != nil {
+		_, commits := GetCommitments(msg)
+		size, receivers = len(msg)/2, len(commits) // hex encoded envelope
+	}
+
+	return SendPreview{
+		Size:      size,
+		Receivers: receivers,
+		Ringsize:  t.Ringsize,
+		Fees:      f,
+		Balance:   b.Unlocked_Balance,
+	}, nil
+}
+
+func (p SendPreview) String() string {
+
+	s := fmt.Sprintf("Ciphertext: %d bytes\nReceivers: %d\nRingsize: %d\n\n", p.Size, p.Receivers, p.Ringsize)
+	s += fmt.Sprintf("Storage gas: %s DERO\nCompute gas: %s DERO\nNetwork fee: %s DERO (%d bytes of SC data)\nTotal: %s DERO\n\n",
+		FormatDERO(p.Fees.GasStorage), FormatDERO(p.Fees.GasCompute), FormatDERO(p.Fees.Network), p.Fees.SCData, FormatDERO(p.Fees.Total))
+	s += fmt.Sprintf("Wallet balance: %s DERO", FormatDERO(p.Balance))
+	if p.Fees.Total > p.Balance {
+		s += "\n\nThe balance doesn't cover the fees!"
+	}
+
+	return s
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/deroproject/derohe/config"
+	"github.com/deroproject/derohe/cryptography/crypto"
+	"github.com/deroproject/derohe/rpc"
+)
+
+func TestNetworkFee(t *testing.T) {
+
+	tests := []struct {
+		transfers int
+		ringsize  uint64
+		sc_data   int
+		want      uint64
+	}{
+		{1, 2, 0, 3 * config.FEE_PER_KB},
+		{1, 16, 0, 3 * 2 * config.FEE_PER_KB},
+		{1, 128, 0, 3 * 9 * config.FEE_PER_KB},
+		{4, 32, 0, 6 * 3 * config.FEE_PER_KB},
+		// 1.5 per byte of SC data, rounded down
+		{1, 16, 1001, 3*2*config.FEE_PER_KB + 1501},
+	}
+	for _, tt := range tests {
+		if got := NetworkFee(tt.transfers, tt.ringsize, tt.sc_data); got != tt.want {
+			t.Errorf("NetworkFee(%d, %d, %d) = %d, want %d", tt.transfers, tt.ringsize, tt.sc_data, got, tt.want)
+		}
+	}
+}
+
+func TestSCArguments(t *testing.T) {
+
+	scid := strings.Repeat("ab", 32)
+	p := Transfer_Params{
+		SC_RPC: Arguments{
+			{Name: "entrypoint", DataType: DataString, Value: "Store"},
+			{Name: "SC_ACTION", DataType: "U", Value: 0},
+			{Name: "SC_ID", DataType: DataHash, Value: scid},
+		},
+	}
+
+	args, err := SCArguments(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// same bytes as the typed arguments the wallet builds
+	want := rpc.Arguments{
+		{Name: "entrypoint", DataType: rpc.DataString, Value: "Store"},
+		{Name: rpc.SCACTION, DataType: rpc.DataUint64, Value: uint64(rpc.SC_CALL)},
+		{Name: rpc.SCID, DataType: rpc.DataHash, Value: crypto.HashHexToHash(scid)},
+	}
+	got_data, err := args.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want_data, err := want.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got_data) != string(want_data) {
+		t.Errorf("serialized arguments differ:\n%x\n%x", got_data, want_data)
+	}
+
+	// the wallet adds the install arguments for new code
+	p = Transfer_Params{SC_Code: "Function Initialize() Uint64\n10 RETURN 0\nEnd Function"}
+	if args, err = SCArguments(p); err != nil {
+		t.Fatal(err)
+	}
+	if !args.Has(rpc.SCCODE, rpc.DataString) || !args.Has(rpc.SCACTION, rpc.DataUint64) {
+		t.Errorf("install arguments missing: %v", args)
+	}
+}
+
+func TestEstimateFees(t *testing.T) {
+
+	defer func(max uint64) { SC_Config.MaxFee = max }(SC_Config.MaxFee)
+	SC_Config.MaxFee = 0
+
+	msg := strings.Repeat("ab", 500)
+	p := Transfer_Params{
+		SC_RPC:    Arguments{{Name: "entrypoint", DataType: DataString, Value: "Store"}, {Name: "data", DataType: DataString, Value: msg}},
+		Ringsize:  16,
+		Transfers: []Transfer{{}},
+	}
+	gas := GasEstimate_Result{GasStorage: 1200, GasCompute: 300}
+
+	f, err := EstimateFees(p, gas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.SCData < uint64(len(msg)) {
+		t.Errorf("SC data of %d bytes is smaller than the message", f.SCData)
+	}
+	if f.Network != NetworkFee(1, 16, int(f.SCData)) || f.Total != f.Network+1500 {
+		t.Errorf("unexpected fees %+v", f)
+	}
+
+	SC_Config.MaxFee = f.Total - 1
+	if _, err := EstimateFees(p, gas); err == nil {
+		t.Error("fee above the maximum accepted")
+	}
+}
@@ -1,6 +1,7 @@
 module dShout
 
-go 1.21.5
+// crypto/mlkem (hybrid post-quantum mode) is part of the standard library since Go 1.24
+go 1.24
 
 require (
 	fyne.io/fyne v1.4.3
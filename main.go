@@ -1,6 +1,8 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"os"
 )
 
@@ -8,10 +10,15 @@ var err error
 
 func main() {
 
+	verify := flag.String("verify", "", "verify a disclosure proof")
+	daemon := flag.Bool("daemon", false, "run without UI, send scheduled messages and check for new ones")
+	relay := flag.Bool("relay", false, "daemon mode, post envelopes of other users in batches")
+	flag.Parse()
+
 	if err := ReadConfig(); err != nil {
 		os.Exit(1)
 	}
-	//Init_JSON_Clients()
+	Init_JSON_Clients()
 
 	xswd = XSWD_Init()
 	xswd.AppInfo = &AppicationInfo{
@@ -27,11 +34,59 @@ func main() {
 
 	defer xswd.XSWD_Exit()
 
+	// third party verification doesn't need the wallet key
+	if *verify != "" {
+		content, err := VerifyDisclosureFile(*verify)
+		if err != nil {
+			log_xswd.Println("Verification failed:", err)
+			return
+		}
+		log_xswd.Println("Verification successful")
+		fmt.Println(content)
+		return
+	}
+
+	// unknown contract code only allows reading
+	warnings := SC_VerifyContracts()
+
 	// ask for permission
 	if privateKey, err = GetWalletKey(); err != nil {
 		log_xswd.Println("No permission for QueryKey")
 		os.Exit(1)
 	}
 
-	CreateWindow().ShowAndRun()
+	// a passphrase protected database gets unlocked in the UI or by the daemon
+	if !SC_Config.Password {
+		if err := DB_Open(""); err != nil {
+			log_xswd.Println("Can't open database:", err)
+			os.Exit(1)
+		}
+	}
+
+	if *relay {
+		if err := RunRelay(); err != nil {
+			log_xswd.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *daemon {
+		if err := RunDaemon(); err != nil {
+			log_xswd.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	CreateWindow(warnings).ShowAndRun()
+
+	// sends started from the UI finish and store their result
+	SendShutdown()
+}
+
+// loops of the UI mode, started once the database is open
+func StartBackground() {
+
+	go OutboxLoop()
+	go CoverLoop()
 }
@@ -0,0 +1,563 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deroproject/derohe/config"
+)
+
+const (
+	OUTBOX_SCHEDULED = "scheduled"
+	OUTBOX_QUEUED    = "queued"
+	OUTBOX_SENDING   = "sending"
+	OUTBOX_SENT      = "sent"
+	OUTBOX_FAILED    = "failed"
+	OUTBOX_CONFIRMED = "confirmed"
+	OUTBOX_UNKNOWN   = "unknown" // may have been sent, looked up on chain before a retry
+)
+
+// how often queued envelopes and sent transactions are checked
+const OUTBOX_INTERVAL = time.Minute
+
+// blocks after a send attempt until an envelope that isn't on chain counts as not sent
+const OUTBOX_LOOKUP_BLOCKS = 20
+
+// prepared envelope, kept until its transaction is confirmed
+type OutboxItem struct {
+	ID        int64    `json:"id"`
+	SCID      string   `json:"scid"`
+	Envelope  string   `json:"envelope"`
+	Ringsize  string   `json:"ringsize"`
+	Key       string   `json:"key"`
+	Receivers []string `json:"receivers"`
+	Created   string   `json:"created"`
+	State     string   `json:"state"`
+	TXID      string   `json:"txid,omitempty"`
+	TX        string   `json:"tx,omitempty"` // signed transaction until it's confirmed
+	Attempts  int      `json:"attempts"`
+	Since     uint64   `json:"since,omitempty"` // chain height before the last attempt
+	Error     string   `json:"error,omitempty"`
+	Schedule  Schedule `json:"schedule"`
+}
+
+var outbox []OutboxItem
+var outbox_mu sync.Mutex
+
+// sends in flight hold a read lock until their result is stored, SendShutdown waits for them
+var send_mu sync.RWMutex
+var send_stopped bool
+
+var ErrShutdown = errors.New("shutting down, nothing is sent anymore")
+
+// start a send, false once SendShutdown was called
+func send_begin() bool {
+
+	send_mu.RLock()
+	if send_stopped {
+		send_mu.RUnlock()
+		return false
+	}
+
+	return true
+}
+
+func send_end() {
+	send_mu.RUnlock()
+}
+
+// wait for running sends and refuse new ones
+func SendShutdown() {
+
+	send_mu.Lock()
+	send_stopped = true
+	send_mu.Unlock()
+}
+
+// a scheduled entry is queued once its height or time is reached
+func OutboxAdd(scid string, envelope string, ringsize string, key [32]byte, receivers []string, s Schedule) (int64, error) {
+
+	state := OUTBOX_QUEUED
+	if !s.IsZero() {
+		state = OUTBOX_SCHEDULED
+	}
+
+	outbox_mu.Lock()
+	id := time.Now().UnixNano()
+	outbox = append(outbox, OutboxItem{
+		ID:        id,
+		SCID:      scid,
+		Envelope:  envelope,
+		Ringsize:  ringsize,
+		Key:       outbox_key(key),
+		Receivers: receivers,
+		Created:   time.Now().Format(time.DateTime),
+		State:     state,
+		Schedule:  s,
+	})
+	outbox_mu.Unlock()
+
+	return id, DB_Save()
+}
+
+// envelopes that weren't generated here have no key
+func outbox_key(key [32]byte) string {
+	if key == [32]byte{} {
+		return ""
+	}
+	return hex.EncodeToString(key[:])
+}
+
+func outbox_item(id int64) *OutboxItem {
+	for i := range outbox {
+		if outbox[i].ID == id {
+			return &outbox[i]
+		}
+	}
+	return nil
+}
+
+// send a queued or failed envelope, queued entries are sent automatically, failed ones only by hand
+func OutboxSend(id int64) (txid string, err error) {
+	return OutboxSendPack([]int64{id})
+}
+
+// add an envelope and send it at once, the entry is created as sending
+// so OutboxProcess can't pick it up in between
+func OutboxPost(scid string, envelope string, ringsize string, key [32]byte, receivers []string) (txid string, err error) {
+
+	if !send_begin() {
+		return "", ErrShutdown
+	}
+	defer send_end()
+
+	item := OutboxItem{
+		ID:        time.Now().UnixNano(),
+		SCID:      scid,
+		Envelope:  envelope,
+		Ringsize:  ringsize,
+		Key:       outbox_key(key),
+		Receivers: receivers,
+		Created:   time.Now().Format(time.DateTime),
+		State:     OUTBOX_SENDING,
+		Attempts:  1,
+		Since:     chain_height.Load(),
+	}
+	outbox_mu.Lock()
+	outbox = append(outbox, item)
+	outbox_mu.Unlock()
+	if err := DB_Save(); err != nil {
+		log_xswd.Println("Can't store outbox entry:", err)
+	}
+
+	return outbox_send([]OutboxItem{item}, ringsize)
+}
+
+// send several entries of one contract in a single Store call, joined with "+"
+func OutboxSendPack(ids []int64) (txid string, err error) {
+
+	if !send_begin() {
+		return "", ErrShutdown
+	}
+	defer send_end()
+
+	items, ringsize, err := outbox_claim(ids)
+	if err != nil {
+		return "", err
+	}
+
+	return outbox_send(items, ringsize)
+}
+
+// mark queued or failed entries as sending, returns copies and the ringsize to use
+func outbox_claim(ids []int64) (items []OutboxItem, ringsize string, err error) {
+
+	outbox_mu.Lock()
+	defer outbox_mu.Unlock()
+
+	for _, id := range ids {
+		o := outbox_item(id)
+		if o == nil {
+			return nil, "", fmt.Errorf("unknown outbox entry")
+		}
+		if o.State != OUTBOX_QUEUED && o.State != OUTBOX_FAILED {
+			return nil, "", fmt.Errorf("outbox entry is %s", o.State)
+		}
+		if len(items) > 0 && o.SCID != items[0].SCID {
+			return nil, "", fmt.Errorf("entries for different contracts")
+		}
+		if len(items) > 0 && o.Ringsize != items[0].Ringsize {
+			return nil, "", fmt.Errorf("entries with different ringsizes")
+		}
+		items = append(items, *o)
+	}
+	if len(items) == 0 {
+		return nil, "", fmt.Errorf("nothing to send")
+	}
+
+	for _, item := range items {
+		o := outbox_item(item.ID)
+		o.State = OUTBOX_SENDING
+		o.Attempts++
+		o.Since = chain_height.Load()
+	}
+
+	return items, items[0].Ringsize, nil
+}
+
+// send claimed entries, the signed transaction is kept for a rebroadcast
+func outbox_send(items []OutboxItem, ringsize string) (txid string, err error) {
+
+	// stamps expire, the ones of older entries are renewed for the current height
+	if SC_Config.Stamp > 0 {
+		if h, err := GetHeight(); err == nil {
+			for i := range items {
+				items[i].Envelope = RenewStamp(items[i].Envelope, items[i].SCID, h.Height)
+			}
+		}
+	}
+
+	var envelopes []string
+	for _, item := range items {
+		envelopes = append(envelopes, item.Envelope)
+	}
+
+	txid, err = SC_SendMessage(items[0].SCID, strings.Join(envelopes, "+"), ringsize)
+
+	// OutboxProcess fetches it later if the daemon doesn't have it yet
+	var tx string
+	if err == nil {
+		tx, _ = GetTransactionHex(txid)
+	}
+
+	outbox_mu.Lock()
+	for _, item := range items {
+		if o := outbox_item(item.ID); o != nil {
+			o.Envelope = item.Envelope
+			switch {
+			case err == nil:
+				o.State, o.TXID, o.TX, o.Error = OUTBOX_SENT, txid, tx, ""
+			case errors.Is(err, ErrNotSent):
+				// the wallet never got it, sent again after reconnecting
+				o.State, o.Error = OUTBOX_QUEUED, err.Error()
+			case errors.Is(err, ErrConnectionLost) || errors.Is(err, ErrNoResponse):
+				// the wallet may have sent it, OutboxProcess looks for it before a retry
+				o.State, o.Error = OUTBOX_UNKNOWN, err.Error()
+			default:
+				o.State, o.Error = OUTBOX_FAILED, err.Error()
+			}
+		}
+	}
+	outbox_mu.Unlock()
+
+	if err == nil {
+		for _, item := range items {
+			if item.Key == "" {
+				continue
+			}
+			var key [32]byte
+			k, _ := hex.DecodeString(item.Key)
+			copy(key[:], k)
+			if err := AddSent(item.SCID, txid, key, item.Receivers); err != nil {
+				log_xswd.Println("Can't store sent message:", err)
+			}
+		}
+	}
+	DB_Save()
+
+	return txid, err
+}
+
+// send the given entries with as few transactions as possible,
+// entries of one contract and ringsize share a transaction
+func OutboxSendBatch(ids []int64) (sent int, err error) {
+
+	type group struct{ scid, ringsize string }
+
+	outbox_mu.Lock()
+	groups := map[group][]OutboxItem{}
+	var order []group
+	for _, id := range ids {
+		o := outbox_item(id)
+		if o == nil || (o.State != OUTBOX_QUEUED && o.State != OUTBOX_FAILED) {
+			continue
+		}
+		g := group{o.SCID, o.Ringsize}
+		if _, ok := groups[g]; !ok {
+			order = append(order, g)
+		}
+		groups[g] = append(groups[g], *o)
+	}
+	outbox_mu.Unlock()
+
+	limit := BatchLimit()
+	for _, g := range order {
+		items := groups[g]
+		var envelopes []string
+		for _, o := range items {
+			envelopes = append(envelopes, o.Envelope)
+		}
+		for _, pack := range PackEnvelopes(envelopes, limit) {
+			var pack_ids []int64
+			for _, i := range pack {
+				pack_ids = append(pack_ids, items[i].ID)
+			}
+			if _, e := OutboxSendPack(pack_ids); e != nil {
+				err = e
+				continue
+			}
+			sent++
+		}
+	}
+
+	return sent, err
+}
+
+// storage gas of a Store call (store.bas), following the DVM: the serialized SC
+// arguments and every stored byte are charged, a LOAD costs a tenth of the value.
+// joined is the length of "msg" if an earlier call of the same height stored one,
+// the call then loads it and stores it again with the new data appended
+func StoreGas(sc_data int, data int, joined int) int {
+
+	const uint64_value = binary.MaxVarintLen64 + 1 // stored height, with the type byte
+
+	gas := sc_data + 1 // LOAD("height")
+	if joined > 0 {
+		gas += max((joined+1)/10, 1) + joined + 1 + data + 1
+	} else {
+		gas += data + 1 + uint64_value // "msg" and "prev"
+	}
+
+	return gas + uint64_value
+}
+
+// the largest pack whose Store call stays within the storage gas cap even
+// when it's appended to an earlier pack of the same size in the same block
+func BatchLimit() int {
+
+	fits := func(n int) bool {
+		size, err := SCDataSize(Transfer_Params{
+			SC_RPC: SC_InvokeArguments(ZEROHASH, "Store", Arguments{SC_AddMessage(strings.Repeat("0", n))}),
+		})
+		return err == nil && StoreGas(size, n, n) <= config.MAX_STORAGE_GAS_ATOMIC_UNITS
+	}
+
+	lo, hi := 0, config.MAX_STORAGE_GAS_ATOMIC_UNITS
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if fits(mid) {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	limit := lo
+	if SC_Config.BatchLimit > 0 {
+		limit = min(limit, SC_Config.BatchLimit)
+	}
+
+	return limit
+}
+
+// greedy packing in queue order, returns indices of the envelopes per pack.
+// Envelopes above the limit get a pack of their own and fail when sent
+func PackEnvelopes(envelopes []string, limit int) (packs [][]int) {
+
+	var pack []int
+	size := 0
+	for i, e := range envelopes {
+		add := len(e)
+		if len(pack) > 0 {
+			add++ // separator
+		}
+		if len(pack) > 0 && size+add > limit {
+			packs = append(packs, pack)
+			pack, size, add = nil, 0, len(e)
+		}
+		pack = append(pack, i)
+		size += add
+	}
+	if len(pack) > 0 {
+		packs = append(packs, pack)
+	}
+
+	return
+}
+
+func OutboxCancel(id int64) error {
+
+	outbox_mu.Lock()
+	i := slices.IndexFunc(outbox, func(o OutboxItem) bool { return o.ID == id })
+	if i < 0 || outbox[i].State == OUTBOX_SENDING {
+		outbox_mu.Unlock()
+		return fmt.Errorf("entry can't be cancelled")
+	}
+	outbox = slices.Delete(outbox, i, i+1)
+	outbox_mu.Unlock()
+
+	return DB_Save()
+}
+
+// send queued entries, confirm sent ones and rebroadcast dropped transactions
+func OutboxProcess() {
+
+	if !xswd.Connected() {
+		return
+	}
+
+	outbox_mu.Lock()
+	items := slices.Clone(outbox)
+	outbox_mu.Unlock()
+
+	height := chain_height.Load()
+	if slices.ContainsFunc(items, func(o OutboxItem) bool {
+		return o.State == OUTBOX_SCHEDULED && o.Schedule.Height > 0 || o.State == OUTBOX_UNKNOWN
+	}) {
+		if h, err := GetHeight(); err == nil {
+			height = h.Height
+		}
+	}
+
+	changed := false
+	var queued []int64
+	for _, o := range items {
+		switch o.State {
+		case OUTBOX_SCHEDULED:
+			if !o.Schedule.Due(height) {
+				continue
+			}
+			outbox_mu.Lock()
+			if p := outbox_item(o.ID); p != nil && p.State == OUTBOX_SCHEDULED {
+				p.State = OUTBOX_QUEUED
+				queued = append(queued, o.ID)
+				changed = true
+			}
+			outbox_mu.Unlock()
+		case OUTBOX_QUEUED:
+			queued = append(queued, o.ID)
+		case OUTBOX_UNKNOWN:
+			found, err := OutboxLookup(o.SCID, o.Envelope, o.Since)
+			if err != nil {
+				continue
+			}
+			state, msg := OUTBOX_CONFIRMED, ""
+			if !found {
+				if height < o.Since+OUTBOX_LOOKUP_BLOCKS {
+					continue
+				}
+				state, msg = OUTBOX_FAILED, fmt.Sprintf("not stored in the contract within %d blocks", OUTBOX_LOOKUP_BLOCKS)
+			}
+			outbox_mu.Lock()
+			if p := outbox_item(o.ID); p != nil && p.State == OUTBOX_UNKNOWN {
+				p.State, p.Error = state, msg
+				changed = true
+			}
+			outbox_mu.Unlock()
+		case OUTBOX_SENT:
+			tx, err := GetTransaction(o.TXID)
+			if err != nil {
+				continue
+			}
+			state, signed, msg := OUTBOX_SENT, o.TX, ""
+			switch {
+			case tx.In_pool:
+				if o.TX != "" {
+					continue
+				}
+				if signed, err = GetTransactionHex(o.TXID); err != nil {
+					continue
+				}
+			case tx.Block_Height > 0 && tx.ValidBlock != "":
+				state, signed = OUTBOX_CONFIRMED, ""
+			case o.TX == "":
+				state, msg = OUTBOX_FAILED, "dropped from the mempool, check sent messages before retrying"
+			default:
+				// dropped from the mempool, the same transaction is submitted again
+				log_xswd.Println("Outbox: rebroadcasting", o.TXID)
+				if err := SendRawTransaction(o.TX); err != nil {
+					state, msg = OUTBOX_FAILED, err.Error()
+				}
+			}
+			outbox_mu.Lock()
+			if p := outbox_item(o.ID); p != nil && p.State == OUTBOX_SENT {
+				p.State, p.TX = state, signed
+				if msg != "" {
+					p.Error = msg
+				}
+				changed = true
+			}
+			outbox_mu.Unlock()
+		}
+	}
+
+	if len(queued) > 0 {
+		if _, err := OutboxSendBatch(queued); err != nil {
+			log_xswd.Println("Outbox:", err)
+		}
+	}
+
+	if changed {
+		DB_Save()
+	}
+}
+
+// search the messages the contract stored from the given height on for the envelope
+func OutboxLookup(scid string, envelope string, since uint64) (bool, error) {
+	return outbox_lookup(func(height uint64) (GetSC_Result, error) {
+		return SC_GetSnapshotAtHeight(scid, height)
+	}, envelope, since)
+}
+
+// walk back along the prev pointers, starting with the current state
+func outbox_lookup(snapshot func(height uint64) (GetSC_Result, error), envelope string, since uint64) (bool, error) {
+
+	var height uint64
+	for {
+		r, err := snapshot(height)
+		if err != nil {
+			return false, err
+		}
+		if !SC_SanityCheck(r) {
+			return false, nil
+		}
+		h, _ := strconv.ParseUint(r.ValuesString[0], 10, 64)
+		prev, _ := strconv.ParseUint(r.ValuesString[1], 10, 64)
+		if h < since {
+			return false, nil
+		}
+		plain, err := hex.DecodeString(r.ValuesString[2])
+		if err == nil && slices.Contains(GetMessages(string(plain)), envelope) {
+			return true, nil
+		}
+		if prev >= h {
+			return false, nil
+		}
+		height = prev
+	}
+}
+
+func OutboxLoop() {
+
+	xswd.SetOnReconnect(OutboxProcess)
+
+	for {
+		OutboxProcess()
+		time.Sleep(OUTBOX_INTERVAL)
+	}
+}
+
+func OutboxItems() []OutboxItem {
+
+	outbox_mu.Lock()
+	defer outbox_mu.Unlock()
+
+	return slices.Clone(outbox)
+}
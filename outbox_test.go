@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deroproject/derohe/config"
+)
+
+func TestOutboxClaim(t *testing.T) {
+
+	test_db(t)
+
+	a, err := OutboxAdd(TEST_SCID_A, "aa", "16", [32]byte{}, nil, Schedule{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := OutboxAdd(TEST_SCID_A, "bb", "16", [32]byte{}, nil, Schedule{})
+	c, _ := OutboxAdd(TEST_SCID_B, "cc", "16", [32]byte{}, nil, Schedule{})
+	d, _ := OutboxAdd(TEST_SCID_A, "dd", "32", [32]byte{}, nil, Schedule{})
+
+	if _, _, err := outbox_claim([]int64{a, c}); err == nil {
+		t.Error("claimed entries of different contracts")
+	}
+	if _, _, err := outbox_claim([]int64{a, d}); err == nil {
+		t.Error("claimed entries with different ringsizes")
+	}
+
+	items, ringsize, err := outbox_claim([]int64{a, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || ringsize != "16" {
+		t.Errorf("claimed %d entries with ringsize %s", len(items), ringsize)
+	}
+
+	// a claimed entry can't be sent a second time
+	if _, _, err := outbox_claim([]int64{a}); err == nil {
+		t.Error("entry claimed twice")
+	}
+	for _, o := range OutboxItems() {
+		if o.ID == a && (o.State != OUTBOX_SENDING || o.Attempts != 1) {
+			t.Errorf("claimed entry %+v", o)
+		}
+	}
+}
+
+func TestAddSentReplaces(t *testing.T) {
+
+	test_db(t)
+
+	key := [32]byte{1}
+	if err := AddSent(TEST_SCID_A, "tx1", key, []string{"me"}); err != nil {
+		t.Fatal(err)
+	}
+	AddSent(TEST_SCID_A, "tx2", [32]byte{2}, nil)
+
+	// the same envelope sent again
+	AddSent(TEST_SCID_A, "tx3", key, []string{"me"})
+
+	s := SentMessages()
+	if len(s) != 2 || s[0].TXID != "tx3" || s[1].TXID != "tx2" {
+		t.Errorf("sent messages %+v", s)
+	}
+}
+
+func TestOutboxLookup(t *testing.T) {
+
+	// Store calls at heights 100 (two envelopes), 130 and 150, the current state is 150
+	stored := map[uint64][]string{100: {"e1", "e2"}, 130: {"e3"}, 150: {"e4"}}
+	prev := map[uint64]uint64{100: 90, 130: 100, 150: 130}
+	calls := 0
+	snapshot := func(height uint64) (r GetSC_Result, err error) {
+		calls++
+		if height == 0 {
+			height = 150
+		}
+		if height == 90 {
+			// state after Initialize, no messages yet
+			return GetSC_Result{ValuesString: []string{"90", "90", ""}}, nil
+		}
+		msg := hex.EncodeToString([]byte(strings.Join(stored[height], "+")))
+		return GetSC_Result{ValuesString: []string{strconv.FormatUint(height, 10), strconv.FormatUint(prev[height], 10), msg}}, nil
+	}
+
+	tests := []struct {
+		envelope string
+		since    uint64
+		found    bool
+		calls    int
+	}{
+		{"e4", 140, true, 1},
+		{"e2", 95, true, 3},
+		{"e3", 95, true, 2},
+		// stored before the attempt, another send of the same envelope
+		{"e1", 120, false, 3},
+		{"e5", 95, false, 4},
+	}
+	for _, tt := range tests {
+		calls = 0
+		found, err := outbox_lookup(snapshot, tt.envelope, tt.since)
+		if err != nil || found != tt.found || calls != tt.calls {
+			t.Errorf("%s since %d: found %v after %d snapshots, want %v after %d (%v)", tt.envelope, tt.since, found, calls, tt.found, tt.calls, err)
+		}
+	}
+
+	failing := func(uint64) (GetSC_Result, error) { return GetSC_Result{}, errors.New("daemon unreachable") }
+	if _, err := outbox_lookup(failing, "e1", 0); err == nil {
+		t.Error("lookup without daemon succeeded")
+	}
+}
+
+func TestOutboxInterrupted(t *testing.T) {
+
+	test_db(t)
+
+	old, _ := OutboxAdd(TEST_SCID_A, "aa", "16", [32]byte{}, nil, Schedule{})
+	chain_height.Store(500)
+	defer chain_height.Store(0)
+	recent, _ := OutboxAdd(TEST_SCID_A, "bb", "16", [32]byte{}, nil, Schedule{})
+	if _, _, err := outbox_claim([]int64{recent}); err != nil {
+		t.Fatal(err)
+	}
+	outbox_mu.Lock()
+	outbox_item(old).State = OUTBOX_SENDING
+	outbox_mu.Unlock()
+	if err := DB_Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// closed while the wallet had both, restarted
+	db_open = false
+	if err := DB_Open(""); err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range OutboxItems() {
+		if o.ID == recent && o.State != OUTBOX_UNKNOWN {
+			t.Errorf("interrupted entry is %s, want it looked up", o.State)
+		}
+		// no height to look it up from
+		if o.ID == old && o.State != OUTBOX_FAILED {
+			t.Errorf("interrupted entry without height is %s", o.State)
+		}
+	}
+
+	// only looked up, never sent again
+	if _, _, err := outbox_claim([]int64{recent}); err == nil {
+		t.Error("entry of unknown state claimed")
+	}
+}
+
+func TestPackEnvelopes(t *testing.T) {
+
+	e := func(n int) string { return strings.Repeat("a", n) }
+
+	tests := []struct {
+		name      string
+		envelopes []string
+		limit     int
+		want      [][]int
+	}{
+		{"empty", nil, 10, nil},
+		{"one pack", []string{e(3), e(3), e(2)}, 10, [][]int{{0, 1, 2}}},
+		// the separator counts, 3+1+3+1+3 = 11
+		{"separator", []string{e(3), e(3), e(3)}, 10, [][]int{{0, 1}, {2}}},
+		{"queue order", []string{e(6), e(6), e(2)}, 10, [][]int{{0}, {1, 2}}},
+		{"too large", []string{e(2), e(12), e(2)}, 10, [][]int{{0}, {1}, {2}}},
+	}
+	for _, tt := range tests {
+		if got := PackEnvelopes(tt.envelopes, tt.limit); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: packs %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBatchLimit(t *testing.T) {
+
+	defer func(l int) { SC_Config.BatchLimit = l }(SC_Config.BatchLimit)
+	SC_Config.BatchLimit = 0
+
+	limit := BatchLimit()
+	size := func(n int) int {
+		s, err := SCDataSize(Transfer_Params{
+			SC_RPC: SC_InvokeArguments(ZEROHASH, "Store", Arguments{SC_AddMessage(strings.Repeat("0", n))}),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	// appended to an earlier pack of the same size, the limit is the last size that fits
+	if StoreGas(size(limit), limit, limit) > config.MAX_STORAGE_GAS_ATOMIC_UNITS {
+		t.Errorf("pack of %d bytes exceeds the storage gas cap", limit)
+	}
+	if StoreGas(size(limit+1), limit+1, limit+1) <= config.MAX_STORAGE_GAS_ATOMIC_UNITS {
+		t.Errorf("limit %d isn't the largest pack", limit)
+	}
+
+	// the first call of a height is cheaper
+	if StoreGas(size(limit), limit, 0) >= StoreGas(size(limit), limit, limit) {
+		t.Error("append costs no more than a new msg")
+	}
+
+	SC_Config.BatchLimit = 1000
+	if BatchLimit() != 1000 {
+		t.Errorf("batch_limit ignored: %d", BatchLimit())
+	}
+}
+
+func TestSendShutdown(t *testing.T) {
+
+	t.Cleanup(func() { send_stopped = false })
+
+	if !send_begin() {
+		t.Fatal("send refused before shutdown")
+	}
+	stopped := make(chan struct{})
+	go func() {
+		SendShutdown()
+		close(stopped)
+	}()
+
+	// the running send is waited for
+	select {
+	case <-stopped:
+		t.Fatal("shutdown didn't wait for the running send")
+	case <-time.After(50 * time.Millisecond):
+	}
+	send_end()
+	<-stopped
+
+	if send_begin() {
+		t.Error("send started after shutdown")
+	}
+	if _, err := OutboxSendPack([]int64{1}); err != ErrShutdown {
+		t.Errorf("OutboxSendPack after shutdown: %v", err)
+	}
+}
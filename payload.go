@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/deroproject/derohe/rpc"
+	"github.com/deroproject/derohe/transaction"
+)
+
+// short messages can be sent as zero-value transfers, the message goes into the RPC payload
+const (
+	TRANSPORT_SC      = "Smart contract"
+	TRANSPORT_PAYLOAD = "TX payload"
+)
+
+// destination port of dShout payloads ("dShout")
+const PAYLOAD_PORT uint64 = 0x6453686f7574
+
+// first height of the wallet's incoming transfers that wasn't read yet,
+// it's stored with the next DB_Save
+var payload_height uint64
+
+// the payload is encrypted for the receiver by the wallet, only sender and receiver can read it
+func PayloadArguments(msg string) (args Arguments, err error) {
+
+	check := rpc.Arguments{
+		{Name: rpc.RPC_DESTINATION_PORT, DataType: rpc.DataUint64, Value: PAYLOAD_PORT},
+		{Name: rpc.RPC_COMMENT, DataType: rpc.DataString, Value: msg},
+	}
+	if _, err = check.CheckPack(transaction.PAYLOAD0_LIMIT); err != nil {
+		return nil, fmt.Errorf("message is too long for a TX payload (%d bytes at most)", PayloadMaxLength())
+	}
+
+	return Arguments{
+		{Name: rpc.RPC_DESTINATION_PORT, DataType: "U", Value: PAYLOAD_PORT},
+		{Name: rpc.RPC_COMMENT, DataType: DataString, Value: msg},
+	}, nil
+}
+
+// longest message that fits into a payload
+func PayloadMaxLength() (n int) {
+
+	for {
+		check := rpc.Arguments{
+			{Name: rpc.RPC_DESTINATION_PORT, DataType: rpc.DataUint64, Value: PAYLOAD_PORT},
+			{Name: rpc.RPC_COMMENT, DataType: rpc.DataString, Value: string(make([]byte, n+1))},
+		}
+		if _, err := check.CheckPack(transaction.PAYLOAD0_LIMIT); err != nil {
+			return n
+		}
+		n++
+	}
+}
+
+// one zero-value transfer per receiver, all in one transaction
+func PayloadPrepareMessage(receivers []string, msg string, ringsize string) (t Transfer_Params, f FeeBreakdown, err error) {
+
+	if len(receivers) == 0 {
+		return t, f, fmt.Errorf("no (valid) receivers")
+	}
+	if t.Ringsize, err = strconv.ParseUint(ringsize, 10, 64); err != nil {
+		return t, f, err
+	}
+
+	args, err := PayloadArguments(msg)
+	if err != nil {
+		return t, f, err
+	}
+	for _, r := range receivers {
+		if IsChannel(r) {
+			return t, f, fmt.Errorf("channels can't receive TX payloads")
+		}
+		t.Transfers = append(t.Transfers, Transfer{
+			SCID:        ZEROHASH,
+			Destination: r,
+			Amount:      0,
+			Payload_RPC: args,
+		})
+	}
+
+	if f, err = EstimateFees(t, GasEstimate_Result{}); err != nil {
+		return t, f, err
+	}
+	t.Fees = f.Total
+
+	return t, f, nil
+}
+
+// pick up payload messages from the wallet's incoming transfers
+func PayloadSync() (count int, err error) {
+
+	var r GetTransfers_Result
+	if err = xswd.Call(WALLET_GET_TRANSFERS, GetTransfers_Params{
+		SCID:       ZEROHASH,
+		In:         true,
+		Min_Height: payload_height,
+	}, &r); err != nil {
+		return 0, err
+	}
+
+	next := payload_height
+	for _, e := range r.Entries {
+		next = max(next, e.Height+1)
+		if e.DestinationPort != PAYLOAD_PORT {
+			continue
+		}
+		var msg string
+		for _, a := range e.Payload_RPC {
+			if a.Name == rpc.RPC_COMMENT {
+				msg, _ = a.Value.(string)
+			}
+		}
+		if msg == "" {
+			continue
+		}
+
+		m := MsgDecryped{
+			Message: msg,
+			Block:   e.Height,
+			Time:    e.Time.Format(time.DateTime),
+			TXID:    e.TXID,
+			Sender:  e.Sender,
+		}
+		SetExpiry(&m, e.Time)
+		if m.Expired() {
+			continue
+		}
+		if AddMessage(m) {
+			count++
+		}
+	}
+	db_mu.Lock()
+	payload_height = next
+	db_mu.Unlock()
+
+	if count == 0 {
+		return 0, nil
+	}
+	log_xswd.Printf("Found %d payload message(s)\n", count)
+
+	return count, DB_Save()
+}
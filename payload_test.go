@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/deroproject/derohe/rpc"
+	"github.com/deroproject/derohe/transaction"
+)
+
+func TestPayloadMaxLength(t *testing.T) {
+
+	n := PayloadMaxLength()
+	if n <= 0 || n >= transaction.PAYLOAD0_LIMIT {
+		t.Fatalf("maximum length %d", n)
+	}
+
+	if _, err := PayloadArguments(strings.Repeat("a", n)); err != nil {
+		t.Errorf("message of the maximum length rejected: %v", err)
+	}
+	if _, err := PayloadArguments(strings.Repeat("a", n+1)); err == nil {
+		t.Error("message above the maximum length accepted")
+	}
+}
+
+func TestPayloadArguments(t *testing.T) {
+
+	args, err := PayloadArguments("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the wallet decodes them by type, the port has to be a uint64
+	p := Transfer_Params{SC_RPC: args}
+	decoded, err := SCArguments(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.HasValue(rpc.RPC_DESTINATION_PORT, rpc.DataUint64) || decoded.Value(rpc.RPC_DESTINATION_PORT, rpc.DataUint64).(uint64) != PAYLOAD_PORT {
+		t.Errorf("destination port missing: %v", decoded)
+	}
+	if decoded.Value(rpc.RPC_COMMENT, rpc.DataString) != "hello" {
+		t.Errorf("comment missing: %v", decoded)
+	}
+}
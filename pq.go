@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/mlkem"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/deroproject/derohe/cryptography/crypto"
+	"github.com/deroproject/derohe/globals"
+)
+
+// hybrid envelope: public key + commitments + "x" + ML-KEM entries + "q" + encrypted message
+const PQ_SEPARATOR = "q"
+const PQ_ENTRY_SIZE = mlkem.CiphertextSize768 + 32
+const PQ_KEY_PREFIX = "mlkem_"
+
+var mlkemKey *mlkem.DecapsulationKey768
+
+// ML-KEM key is derived from the wallet key, nothing to back up
+func MLKEMKey() (*mlkem.DecapsulationKey768, error) {
+
+	if mlkemKey != nil {
+		return mlkemKey, nil
+	}
+
+	seed := sha512.Sum512(append([]byte("dShout ML-KEM"), crypto.ConvertBigIntToByte(privateKey)...))
+	key, err := mlkem.NewDecapsulationKey768(seed[:])
+	if err != nil {
+		return nil, err
+	}
+	mlkemKey = key
+
+	return mlkemKey, nil
+}
+
+// encapsulate a random secret for every receiver and combine it with the classic key
+func HybridEncapsulate(receivers []string, classic [32]byte) (entries string, key [32]byte, err error) {
+
+	if SC_Config.Registry == "" {
+		return "", key, fmt.Errorf("no ML-KEM registry configured")
+	}
+
+	var secret [32]byte
+	if _, err = rand.Read(secret[:]); err != nil {
+		return "", key, err
+	}
+
+	for _, a := range receivers {
+		if IsChannel(a) {
+			return "", key, fmt.Errorf("channels don't support ML-KEM")
+		}
+		ek_bytes, err := RPC_GetMLKEMKey(a)
+		if err != nil {
+			return "", key, fmt.Errorf("%s: %s", a, err)
+		}
+		ek, err := mlkem.NewEncapsulationKey768(ek_bytes)
+		if err != nil {
+			return "", key, err
+		}
+
+		shared, ct := ek.Encapsulate()
+		wrap := PQWrap(secret, shared)
+		entries += hex.EncodeToString(append(ct, wrap[:]...))
+	}
+
+	return entries, HybridKey(classic, secret), nil
+}
+
+func HybridKey(classic [32]byte, secret [32]byte) [32]byte {
+	return sha256.Sum256(append(classic[:], secret[:]...))
+}
+
+// xor the secret with a key derived from the ML-KEM shared key
+func PQWrap(secret [32]byte, shared []byte) (wrap [32]byte) {
+
+	mask := sha256.Sum256(append([]byte("dShout hybrid wrap"), shared...))
+	for i := range wrap {
+		wrap[i] = secret[i] ^ mask[i]
+	}
+
+	return
+}
+
+// decapsulate an entry and derive the hybrid key
+func HybridUnwrap(classic [32]byte, entry []byte) (key [32]byte, err error) {
+
+	if len(entry) != PQ_ENTRY_SIZE {
+		return key, fmt.Errorf("invalid ML-KEM entry")
+	}
+	dk, err := MLKEMKey()
+	if err != nil {
+		return key, err
+	}
+	shared, err := dk.Decapsulate(entry[:mlkem.CiphertextSize768])
+	if err != nil {
+		return key, err
+	}
+
+	var wrap [32]byte
+	copy(wrap[:], entry[mlkem.CiphertextSize768:])
+
+	return HybridKey(classic, PQWrap(wrap, shared)), nil
+}
+
+// split ML-KEM entries and message
+func GetPQ(payload string) (entries [][]byte, msg string) {
+
+	if !strings.Contains(payload, PQ_SEPARATOR) {
+		return nil, payload
+	}
+	i := strings.Index(payload, PQ_SEPARATOR)
+	data, err := hex.DecodeString(payload[:i])
+	if err != nil || len(data)%PQ_ENTRY_SIZE != 0 {
+		return nil, payload
+	}
+	for len(data) > 0 {
+		entries = append(entries, data[:PQ_ENTRY_SIZE])
+		data = data[PQ_ENTRY_SIZE:]
+	}
+
+	return entries, payload[i+1:]
+}
+
+// registry lookup by public key
+func PQRegistryKey(address string) (string, error) {
+
+	addr, err := globals.ParseValidateAddress(address)
+	if err != nil {
+		return "", err
+	}
+
+	return PQ_KEY_PREFIX + hex.EncodeToString(addr.PublicKey.EncodeCompressed()), nil
+}
+
+func RPC_GetMLKEMKey(address string) ([]byte, error) {
+
+	name, err := PQRegistryKey(address)
+	if err != nil {
+		return nil, err
+	}
+
+	var r GetSC_Result
+	if err = xswd.Call(DAEMON_GET_SC, GetSC_Params{
+		SCID:       SC_Config.Registry,
+		KeysString: []string{name},
+	}, &r); err != nil {
+		return nil, err
+	}
+	if len(r.ValuesString) != 1 {
+		return nil, fmt.Errorf("no ML-KEM key published")
+	}
+
+	// values are returned hex encoded, the stored key itself is hex too
+	stored, err := hex.DecodeString(r.ValuesString[0])
+	if err != nil {
+		return nil, fmt.Errorf("no ML-KEM key published")
+	}
+	key, err := hex.DecodeString(string(stored))
+	if err != nil || len(key) != mlkem.EncapsulationKeySize768 {
+		return nil, fmt.Errorf("invalid ML-KEM key")
+	}
+
+	return key, nil
+}
+
+// publish our encapsulation key, the registry needs a known signer
+func SC_PublishMLKEMKey() (txid string, err error) {
+
+	if SC_Config.Registry == "" {
+		return "", fmt.Errorf("no ML-KEM registry configured")
+	}
+	dk, err := MLKEMKey()
+	if err != nil {
+		return "", err
+	}
+
+	return SC_Invoke(SC_Config.Registry, "Register", Arguments{
+		Argument{
+			Name:     "key",
+			DataType: DataString,
+			Value:    hex.EncodeToString(dk.EncapsulationKey().Bytes()),
+		},
+	}, 2)
+}
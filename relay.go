@@ -0,0 +1,488 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	RELAY_PENDING   = "pending"
+	RELAY_SENT      = "sent"
+	RELAY_CONFIRMED = "confirmed"
+	RELAY_FAILED    = "failed"
+)
+
+// batching policy defaults
+const (
+	RELAY_LISTEN    = "127.0.0.1:44380"
+	RELAY_BATCH     = 3
+	RELAY_DELAY     = 10 * time.Minute
+	RELAY_INTERVAL  = 30 * time.Second
+	RELAY_RINGSIZE  = "16"
+	RELAY_MAX_BODY  = 1 << 20
+	RELAY_ID_LENGTH = 16
+)
+
+// envelope handed to the relay, fees of a batch are split by envelope size
+type RelayItem struct {
+	ID        string `json:"id"`
+	Submitter string `json:"submitter"`
+	SCID      string `json:"scid"`
+	Envelope  string `json:"envelope"`
+	Received  string `json:"received"`
+	State     string `json:"state"`
+	TXID      string `json:"txid,omitempty"`
+	Height    int64  `json:"height,omitempty"`
+	Fee       uint64 `json:"fee,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// delivery receipt, the envelope hash and TXID let the submitter find the envelope on chain
+type RelayReceipt struct {
+	ID       string `json:"id"`
+	State    string `json:"state"`
+	SCID     string `json:"scid"`
+	Envelope string `json:"envelope_hash"`
+	TXID     string `json:"txid,omitempty"`
+	Height   int64  `json:"height,omitempty"`
+	Fee      uint64 `json:"fee,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type RelayAccount struct {
+	Submitter string `json:"submitter"`
+	Messages  int    `json:"messages"`
+	Pending   int    `json:"pending"`
+	Fees      uint64 `json:"fees"`
+}
+
+var relay_items []RelayItem
+var relay_mu sync.Mutex
+
+// serve the intake API and post batches, blocks like the daemon mode
+func RunRelay() error {
+
+	if len(SC_Config.RelayTokens) == 0 {
+		return fmt.Errorf("no relay_tokens configured")
+	}
+	// nothing is accepted before the database can store it
+	if err := DaemonOpen(); err != nil {
+		return err
+	}
+	listen := SC_Config.RelayListen
+	if listen == "" {
+		listen = RELAY_LISTEN
+	}
+
+	go func() {
+		log_xswd.Println("Relay listening on", listen)
+		if err := http.ListenAndServe(listen, relay_mux()); err != nil {
+			log_xswd.Println("Relay:", err)
+		}
+	}()
+	go RelayLoop()
+
+	return daemon_loop()
+}
+
+func relay_mux() *http.ServeMux {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /submit", relay_submit)
+	mux.HandleFunc("GET /receipt/{id}", relay_receipt)
+	mux.HandleFunc("GET /account", relay_account)
+
+	return mux
+}
+
+func RelayLoop() {
+
+	for {
+		time.Sleep(RELAY_INTERVAL)
+		if !xswd.Connected() {
+			continue
+		}
+		RelayConfirm()
+		RelayProcess()
+	}
+}
+
+// submitter of the bearer token, empty if unknown
+func relay_auth(r *http.Request) string {
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+
+	return SC_Config.RelayTokens[token]
+}
+
+func relay_json(w http.ResponseWriter, code int, v any) {
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func relay_error(w http.ResponseWriter, code int, err string) {
+	relay_json(w, code, map[string]string{"error": err})
+}
+
+func relay_submit(w http.ResponseWriter, r *http.Request) {
+
+	submitter := relay_auth(r)
+	if submitter == "" {
+		relay_error(w, http.StatusUnauthorized, "unknown token")
+		return
+	}
+
+	var req struct {
+		SCID     string `json:"scid"`
+		Envelope string `json:"envelope"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, RELAY_MAX_BODY)).Decode(&req); err != nil {
+		relay_error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := RelayAdd(submitter, req.SCID, req.Envelope)
+	if err != nil {
+		relay_error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	receipt, _ := RelayGetReceipt(id)
+	relay_json(w, http.StatusAccepted, receipt)
+}
+
+func relay_receipt(w http.ResponseWriter, r *http.Request) {
+
+	submitter := relay_auth(r)
+	if submitter == "" {
+		relay_error(w, http.StatusUnauthorized, "unknown token")
+		return
+	}
+
+	relay_mu.Lock()
+	i := slices.IndexFunc(relay_items, func(item RelayItem) bool { return item.ID == r.PathValue("id") })
+	own := i >= 0 && relay_items[i].Submitter == submitter
+	relay_mu.Unlock()
+	if !own {
+		relay_error(w, http.StatusNotFound, "unknown id")
+		return
+	}
+
+	receipt, _ := RelayGetReceipt(r.PathValue("id"))
+	relay_json(w, http.StatusOK, receipt)
+}
+
+func relay_account(w http.ResponseWriter, r *http.Request) {
+
+	submitter := relay_auth(r)
+	if submitter == "" {
+		relay_error(w, http.StatusUnauthorized, "unknown token")
+		return
+	}
+
+	relay_json(w, http.StatusOK, RelayAccounts()[submitter])
+}
+
+// queue an envelope, it's checked like a received one
+func RelayAdd(submitter string, scid string, envelope string) (string, error) {
+
+	if scid == "" {
+		if len(SC_Config.Contracts) == 0 {
+			return "", fmt.Errorf("no contract configured")
+		}
+		scid = SC_Config.Contracts[0].SCID
+	}
+	if _, ok := GetContract(scid); !ok {
+		return "", fmt.Errorf("unknown contract")
+	}
+	if SC_Config.MinStamp > 0 {
+		h, err := GetHeight()
+		if err != nil {
+			return "", err
+		}
+		if !StampCheck(envelope, scid, h.Height) {
+			return "", fmt.Errorf("proof-of-work stamp below %d bits", SC_Config.MinStamp)
+		}
+	}
+	if !SanityCheck(envelope) {
+		return "", fmt.Errorf("invalid envelope")
+	}
+	if _, payload := GetPQ(GetPayload(envelope)); payload == "" {
+		return "", fmt.Errorf("invalid envelope")
+	} else if _, err := PayloadCheck(payload); err != nil {
+		return "", fmt.Errorf("invalid envelope")
+	}
+	if len(envelope) > BatchLimit() {
+		return "", fmt.Errorf("envelope is too large")
+	}
+
+	var b [RELAY_ID_LENGTH]byte
+	rand.Read(b[:])
+	id := hex.EncodeToString(b[:])
+
+	item := RelayItem{
+		ID:        id,
+		Submitter: submitter,
+		SCID:      scid,
+		Envelope:  envelope,
+		Received:  time.Now().Format(time.DateTime),
+		State:     RELAY_PENDING,
+	}
+
+	// the submitter only gets an ID for a stored envelope. The item is only added
+	// after it was written, no other save can store it in between
+	db_mu.Lock()
+	defer db_mu.Unlock()
+
+	db := db_state()
+	db.Relay = append(db.Relay, item)
+	if err := db_write(db); err != nil {
+		return "", err
+	}
+
+	relay_mu.Lock()
+	relay_items = append(relay_items, item)
+	relay_mu.Unlock()
+
+	return id, nil
+}
+
+func RelayGetReceipt(id string) (RelayReceipt, error) {
+
+	relay_mu.Lock()
+	defer relay_mu.Unlock()
+
+	i := slices.IndexFunc(relay_items, func(item RelayItem) bool { return item.ID == id })
+	if i < 0 {
+		return RelayReceipt{}, fmt.Errorf("unknown id")
+	}
+	item := relay_items[i]
+	hash := sha256.Sum256([]byte(item.Envelope))
+
+	return RelayReceipt{
+		ID:       item.ID,
+		State:    item.State,
+		SCID:     item.SCID,
+		Envelope: hex.EncodeToString(hash[:]),
+		TXID:     item.TXID,
+		Height:   item.Height,
+		Fee:      item.Fee,
+		Error:    item.Error,
+	}, nil
+}
+
+func RelayAccounts() map[string]RelayAccount {
+
+	relay_mu.Lock()
+	defer relay_mu.Unlock()
+
+	accounts := map[string]RelayAccount{}
+	for _, s := range SC_Config.RelayTokens {
+		accounts[s] = RelayAccount{Submitter: s}
+	}
+	for _, item := range relay_items {
+		a := accounts[item.Submitter]
+		a.Submitter = item.Submitter
+		a.Messages++
+		if item.State == RELAY_PENDING {
+			a.Pending++
+		}
+		a.Fees += item.Fee
+		accounts[item.Submitter] = a
+	}
+
+	return accounts
+}
+
+// a contract's pending envelopes are posted once there are enough of them or the oldest has waited long enough
+func RelayDue(items []RelayItem) bool {
+
+	batch := SC_Config.RelayBatch
+	if batch < 1 {
+		batch = RELAY_BATCH
+	}
+	delay := RELAY_DELAY
+	if d, err := time.ParseDuration(SC_Config.RelayDelay); err == nil && d > 0 {
+		delay = d
+	}
+
+	if len(items) >= batch {
+		return true
+	}
+	for _, item := range items {
+		if t, err := time.ParseInLocation(time.DateTime, item.Received, time.Local); err == nil && time.Since(t) >= delay {
+			return true
+		}
+	}
+
+	return false
+}
+
+// post due envelopes in random order, one Store call per pack
+func RelayProcess() {
+
+	relay_mu.Lock()
+	pending := map[string][]RelayItem{}
+	for _, item := range relay_items {
+		if item.State == RELAY_PENDING {
+			pending[item.SCID] = append(pending[item.SCID], item)
+		}
+	}
+	relay_mu.Unlock()
+
+	for scid, items := range pending {
+		if !RelayDue(items) {
+			continue
+		}
+
+		// the order of arrival must not show up on chain
+		for i := len(items) - 1; i > 0; i-- {
+			j := random_below(uint64(i + 1))
+			items[i], items[j] = items[j], items[i]
+		}
+
+		var envelopes []string
+		for _, item := range items {
+			envelopes = append(envelopes, item.Envelope)
+		}
+		for _, pack := range PackEnvelopes(envelopes, BatchLimit()) {
+			var batch []RelayItem
+			for _, i := range pack {
+				batch = append(batch, items[i])
+			}
+			relay_send(scid, batch)
+		}
+	}
+
+	DB_Save()
+}
+
+func relay_send(scid string, batch []RelayItem) {
+
+	var envelopes []string
+	for _, item := range batch {
+		envelopes = append(envelopes, item.Envelope)
+	}
+
+	if !send_begin() {
+		return
+	}
+	defer send_end()
+
+	t, f, err := SC_PrepareMessage(scid, strings.Join(envelopes, "+"), RELAY_RINGSIZE)
+	var txid string
+	if err == nil {
+		txid, err = SC_Transfer(t)
+	}
+	if err != nil {
+		log_xswd.Println("Relay:", err)
+	}
+
+	relay_mu.Lock()
+	defer relay_mu.Unlock()
+
+	fees := RelaySplitFee(f.Total, batch)
+	for n, b := range batch {
+		i := slices.IndexFunc(relay_items, func(item RelayItem) bool { return item.ID == b.ID })
+		if i < 0 {
+			continue
+		}
+		if err != nil {
+			// the wallet never got it, try again with the next batch. Once handed
+			// to the wallet it may have been sent, it isn't posted a second time
+			if !errors.Is(err, ErrNotSent) {
+				relay_items[i].State, relay_items[i].Error = RELAY_FAILED, err.Error()
+			}
+			continue
+		}
+		relay_items[i].State, relay_items[i].TXID, relay_items[i].Fee, relay_items[i].Error = RELAY_SENT, txid, fees[n], ""
+	}
+}
+
+// the fee is split by envelope size, the last one gets the remainder
+func RelaySplitFee(total uint64, batch []RelayItem) []uint64 {
+
+	size := 0
+	for _, item := range batch {
+		size += len(item.Envelope)
+	}
+
+	fees := make([]uint64, len(batch))
+	var charged uint64
+	for n, item := range batch {
+		if n == len(batch)-1 {
+			fees[n] = total - charged
+			break
+		}
+		fees[n] = total * uint64(len(item.Envelope)) / uint64(size)
+		charged += fees[n]
+	}
+
+	return fees
+}
+
+// confirm sent batches, dropped ones go back to pending
+func RelayConfirm() {
+
+	relay_mu.Lock()
+	txids := map[string]bool{}
+	for _, item := range relay_items {
+		if item.State == RELAY_SENT {
+			txids[item.TXID] = true
+		}
+	}
+	relay_mu.Unlock()
+
+	for txid := range txids {
+		tx, err := GetTransaction(txid)
+		if err != nil || tx.In_pool {
+			continue
+		}
+
+		// the daemon reports the topoheight, receipts show the block height
+		var height int64
+		if tx.Block_Height > 0 && tx.ValidBlock != "" {
+			h, err := GetBlockHeaderByTopo(tx.Block_Height)
+			if err != nil {
+				continue
+			}
+			height = h.Height
+		}
+
+		relay_mu.Lock()
+		for i := range relay_items {
+			if relay_items[i].TXID != txid || relay_items[i].State != RELAY_SENT {
+				continue
+			}
+			if height > 0 {
+				relay_items[i].State, relay_items[i].Height = RELAY_CONFIRMED, height
+			} else {
+				log_xswd.Println("Relay: reposting envelopes of", txid)
+				relay_items[i].State, relay_items[i].TXID, relay_items[i].Fee = RELAY_PENDING, "", 0
+			}
+		}
+		relay_mu.Unlock()
+	}
+}
+
+func RelayItems() []RelayItem {
+
+	relay_mu.Lock()
+	defer relay_mu.Unlock()
+
+	return slices.Clone(relay_items)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRelayDue(t *testing.T) {
+
+	defer func(b int, d string) { SC_Config.RelayBatch, SC_Config.RelayDelay = b, d }(SC_Config.RelayBatch, SC_Config.RelayDelay)
+	SC_Config.RelayBatch, SC_Config.RelayDelay = 0, ""
+
+	received := func(ago time.Duration) RelayItem {
+		return RelayItem{Received: time.Now().Add(-ago).Format(time.DateTime)}
+	}
+	fresh := received(0)
+	old := received(RELAY_DELAY + time.Minute)
+
+	tests := []struct {
+		name  string
+		items []RelayItem
+		batch int
+		delay string
+		due   bool
+	}{
+		{name: "empty", due: false},
+		{name: "waiting", items: []RelayItem{fresh, fresh}, due: false},
+		{name: "full batch", items: []RelayItem{fresh, fresh, fresh}, due: true},
+		{name: "oldest waited", items: []RelayItem{fresh, old}, due: true},
+		{name: "relay_batch", items: []RelayItem{fresh, fresh, fresh}, batch: 5, due: false},
+		{name: "relay_delay", items: []RelayItem{received(2 * time.Minute)}, delay: "1m", due: true},
+		{name: "invalid relay_delay", items: []RelayItem{received(2 * time.Minute)}, delay: "soon", due: false},
+	}
+	for _, tt := range tests {
+		SC_Config.RelayBatch, SC_Config.RelayDelay = tt.batch, tt.delay
+		if got := RelayDue(tt.items); got != tt.due {
+			t.Errorf("%s: due %v, want %v", tt.name, got, tt.due)
+		}
+	}
+}
+
+func TestRelaySplitFee(t *testing.T) {
+
+	item := func(n int) RelayItem { return RelayItem{Envelope: strings.Repeat("a", n)} }
+
+	tests := []struct {
+		total uint64
+		batch []RelayItem
+		want  []uint64
+	}{
+		{300, []RelayItem{item(100)}, []uint64{300}},
+		{300, []RelayItem{item(100), item(200)}, []uint64{100, 200}},
+		// rounding goes to the last envelope
+		{100, []RelayItem{item(1), item(1), item(1)}, []uint64{33, 33, 34}},
+		{0, []RelayItem{item(5), item(5)}, []uint64{0, 0}},
+	}
+	for _, tt := range tests {
+		got := RelaySplitFee(tt.total, tt.batch)
+		var sum uint64
+		for i := range got {
+			sum += got[i]
+			if got[i] != tt.want[i] {
+				t.Errorf("split of %d: %v, want %v", tt.total, got, tt.want)
+				break
+			}
+		}
+		if sum != tt.total {
+			t.Errorf("split of %d sums up to %d", tt.total, sum)
+		}
+	}
+}
+
+func relay_request(t *testing.T, method string, path string, token string, body string) *httptest.ResponseRecorder {
+
+	t.Helper()
+
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	relay_mux().ServeHTTP(w, r)
+
+	return w
+}
+
+func TestRelayHandlers(t *testing.T) {
+
+	test_db(t)
+	defer func(tokens map[string]string) { SC_Config.RelayTokens = tokens }(SC_Config.RelayTokens)
+	SC_Config.RelayTokens = map[string]string{"alice-token": "alice", "bob-token": "bob"}
+
+	me := test_identity(t)
+	envelope, _ := test_envelope(t, "relayed message", false, me)
+	body, _ := json.Marshal(map[string]string{"envelope": envelope})
+
+	if w := relay_request(t, "POST", "/submit", "", string(body)); w.Code != http.StatusUnauthorized {
+		t.Errorf("submit without token: %d", w.Code)
+	}
+	if w := relay_request(t, "POST", "/submit", "alice-token", `{"envelope":"00"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid envelope: %d", w.Code)
+	}
+	if w := relay_request(t, "POST", "/submit", "alice-token", `{"scid":"`+strings.Repeat("0", 64)+`","envelope":"`+envelope+`"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown contract: %d", w.Code)
+	}
+
+	w := relay_request(t, "POST", "/submit", "alice-token", string(body))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("submit: %d %s", w.Code, w.Body)
+	}
+	var receipt RelayReceipt
+	if err := json.Unmarshal(w.Body.Bytes(), &receipt); err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256([]byte(envelope))
+	if receipt.State != RELAY_PENDING || receipt.SCID != TEST_SCID_A || receipt.Envelope != hex.EncodeToString(hash[:]) {
+		t.Errorf("receipt %+v", receipt)
+	}
+
+	// receipts are only shown to their submitter
+	if w := relay_request(t, "GET", "/receipt/"+receipt.ID, "alice-token", ""); w.Code != http.StatusOK {
+		t.Errorf("own receipt: %d", w.Code)
+	}
+	if w := relay_request(t, "GET", "/receipt/"+receipt.ID, "bob-token", ""); w.Code != http.StatusNotFound {
+		t.Errorf("foreign receipt: %d", w.Code)
+	}
+
+	var account RelayAccount
+	w = relay_request(t, "GET", "/account", "alice-token", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &account); err != nil {
+		t.Fatal(err)
+	}
+	if account.Messages != 1 || account.Pending != 1 {
+		t.Errorf("account %+v", account)
+	}
+}
+
+func TestRelayAddUnsaved(t *testing.T) {
+
+	test_db(t)
+	me := test_identity(t)
+	envelope, _ := test_envelope(t, "relayed message", false, me)
+
+	// an envelope that can't be stored isn't accepted
+	db_open = false
+	if _, err := RelayAdd("alice", "", envelope); err == nil {
+		t.Fatal("envelope accepted with a locked database")
+	}
+	if n := len(RelayItems()); n != 0 {
+		t.Errorf("%d relay items kept", n)
+	}
+
+	SC_Config.Contracts = nil
+	if _, err := RelayAdd("alice", "", envelope); err == nil {
+		t.Error("envelope accepted without a contract")
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"sort"
+)
+
+// block hashes of scanned heights
+var block_hashes = map[uint64]string{}
+
+func SC_RecordHash(height uint64) error {
+
+	if height == 0 {
+		return nil
+	}
+	h, err := GetBlockHeader(height)
+	if err != nil {
+		return err
+	}
+	block_hashes[height] = h.Hash
+
+	return nil
+}
+
+// compare recorded hashes with the chain, returns the height to rescan from.
+// Side blocks can replace the block of an unstable height, so a hash is only
+// compared once its height is below the stable height. After that it can't
+// change anymore and is dropped, except the highest one as the last good height.
+func SC_CheckReorg(ctx context.Context) (from uint64, err error) {
+
+	var heights []uint64
+	for h := range block_hashes {
+		if h < stable_height.Load() {
+			heights = append(heights, h)
+		}
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+
+	// first mismatch, everything above the last matching height gets rescanned
+	var good uint64
+	for _, height := range heights {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		h, err := GetBlockHeader(height)
+		if err != nil {
+			return 0, err
+		}
+		if h.Hash != block_hashes[height] {
+			return good + 1, nil
+		}
+		if good > 0 {
+			delete(block_hashes, good)
+		}
+		good = height
+	}
+
+	return 0, nil
+}
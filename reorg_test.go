@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCheckReorg(t *testing.T) {
+
+	defer func(h map[uint64]string) { block_hashes = h }(block_hashes)
+	defer stable_height.Store(stable_height.Load())
+
+	c := new_test_chain(0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14)
+	w := test_walker(t, c)
+
+	block_hashes = map[uint64]string{}
+	stable_height.Store(10)
+	w.Prune(10)
+	for _, h := range []uint64{5, 8, 12} {
+		if err := SC_RecordHash(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// stable hashes are checked once, the highest one is kept
+	if from, err := SC_CheckReorg(context.Background()); err != nil || from != 0 {
+		t.Fatalf("unchanged chain: from %d, %v", from, err)
+	}
+	if _, ok := block_hashes[5]; ok || len(block_hashes) != 2 {
+		t.Errorf("hashes after check: %v", block_hashes)
+	}
+
+	// a side block at the unstable height 12 isn't compared yet
+	c.fork(12, "side", 12, 12, 13, 14)
+	if from, err := SC_CheckReorg(context.Background()); err != nil || from != 0 {
+		t.Fatalf("unstable change: from %d, %v", from, err)
+	}
+
+	// once stable, the changed block triggers a rescan above the last good height
+	stable_height.Store(14)
+	w.Refresh()
+	w.Prune(14)
+	if from, err := SC_CheckReorg(context.Background()); err != nil || from != 9 {
+		t.Fatalf("reorg: from %d, %v, want 9", from, err)
+	}
+}
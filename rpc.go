@@ -1,14 +1,24 @@
 package main
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 const (
 	DAEMON_BLOCK              = "DERO.GetBlock"
+	DAEMON_BLOCK_HEADER_TOPO  = "DERO.GetBlockHeaderByTopoHeight"
+	DAEMON_GET_HEIGHT         = "DERO.GetHeight"
+	DAEMON_GET_TX             = "DERO.GetTransaction"
 	DAEMON_GET_SC             = "DERO.GetSC"
 	DAEMON_GET_RANDOM_ADDRESS = "DERO.GetRandomAddress"
 	DAEMON_GAS_ESTIMATE       = "DERO.GetGasEstimate"
 	DAEMON_NAME_TO_ADDRESS    = "DERO.NameToAddress"
+	DAEMON_SEND_RAW_TX        = "DERO.SendRawTransaction"
 	WALLET_QUERY_KEY          = "QueryKey"
+	WALLET_GET_ADDRESS        = "GetAddress"
+	WALLET_GET_BALANCE        = "GetBalance"
+	WALLET_GET_TRANSFERS      = "GetTransfers"
 	WALLET_SC_INVOKE          = "scinvoke"
 	WALLET_TRANSFER           = "transfer"
 )
@@ -59,6 +69,16 @@ type (
 	}
 )
 
+type (
+	GetBlockHeaderByTopoHeight_Params struct {
+		TopoHeight uint64 `json:"topoheight"`
+	}
+	GetBlockHeader_Result struct {
+		Block_Header BlockHeader_Print `json:"block_header"`
+		Status       string            `json:"status"`
+	}
+)
+
 type BlockHeader_Print struct {
 	Depth         int64    `json:"depth"`
 	Difficulty    string   `json:"difficulty"`
@@ -79,6 +99,13 @@ type BlockHeader_Print struct {
 	Timestamp uint64   `json:"timestamp"`
 }
 
+type GetHeight_Result struct {
+	Height       uint64 `json:"height"`
+	StableHeight int64  `json:"stableheight"`
+	TopoHeight   int64  `json:"topoheight"`
+	Status       string `json:"status"`
+}
+
 type (
 	NameToAddress_Params struct {
 		Name       string `json:"name"`
@@ -113,6 +140,32 @@ type (
 		Status             string                 `json:"status"`
 	}
 )
+type (
+	GetTransaction_Params struct {
+		Tx_Hashes []string `json:"txs_hashes"`
+	}
+	GetTransaction_Result struct {
+		Txs_as_hex []string          `json:"txs_as_hex"`
+		Txs        []Tx_Related_Info `json:"txs"`
+		Status     string            `json:"status"`
+	}
+	SendRawTransaction_Params struct {
+		Tx_as_hex string `json:"tx_as_hex"`
+	}
+	SendRawTransaction_Result struct {
+		Status string `json:"status"`
+		TXID   string `json:"txid"`
+	}
+	Tx_Related_Info struct {
+		Block_Height int64    `json:"block_height"`
+		Ignored      bool     `json:"ignored"`
+		In_pool      bool     `json:"in_pool"`
+		Tx_hash      string   `json:"tx_hash"`
+		ValidBlock   string   `json:"valid_block"`
+		InvalidBlock []string `json:"invalid_block"`
+	}
+)
+
 type (
 	Query_Key_Params struct {
 		Key_type string `json:"key_type"`
@@ -120,6 +173,37 @@ type (
 	Query_Key_Result struct {
 		Key string `json:"key"`
 	}
+	GetAddress_Result struct {
+		Address string `json:"address"`
+	}
+	GetBalance_Result struct {
+		Balance          uint64 `json:"balance"`
+		Unlocked_Balance uint64 `json:"unlocked_balance"`
+	}
+)
+
+type (
+	GetTransfers_Params struct {
+		SCID       string `json:"scid"`
+		In         bool   `json:"in"`
+		Out        bool   `json:"out"`
+		Min_Height uint64 `json:"min_height"`
+		Max_Height uint64 `json:"max_height,omitempty"`
+	}
+	GetTransfers_Result struct {
+		Entries []Entry `json:"entries,omitempty"`
+	}
+	Entry struct {
+		Height          uint64    `json:"height"`
+		TopoHeight      int64     `json:"topoheight"`
+		Incoming        bool      `json:"incoming"`
+		TXID            string    `json:"txid"`
+		Amount          uint64    `json:"amount"`
+		Time            time.Time `json:"time"`
+		Payload_RPC     Arguments `json:"payload_rpc,omitempty"`
+		Sender          string    `json:"sender"`
+		DestinationPort uint64    `json:"dstport"`
+	}
 )
 
 type (
@@ -164,14 +248,6 @@ type (
 	}
 )
 
-var invoke_params = Arguments{
-	Argument{
-		Name:     "entrypoint",
-		DataType: "S",
-		Value:    "Store",
-	},
-}
-
 func RPC_Request(method string, p any) JSONRPCRequest {
 	return JSONRPCRequest{
 		JSONRPC: "2.0",
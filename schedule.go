@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const SCHEDULE_TIME_FORMAT = "2006-01-02 15:04"
+
+// earliest block height or time to send an outbox entry
+type Schedule struct {
+	Height uint64    `json:"height,omitempty"`
+	Time   time.Time `json:"time,omitempty"`
+}
+
+func (s Schedule) IsZero() bool {
+	return s.Height == 0 && s.Time.IsZero()
+}
+
+func (s Schedule) String() string {
+	if s.Height > 0 {
+		return fmt.Sprintf("height %d", s.Height)
+	}
+	if !s.Time.IsZero() {
+		return s.Time.Format(time.DateTime)
+	}
+	return "now"
+}
+
+func (s Schedule) Due(height uint64) bool {
+	if s.Height > 0 {
+		return height >= s.Height
+	}
+	return !time.Now().Before(s.Time)
+}
+
+// "at" is a block height ("1234567"), a time ("2006-01-02 15:04") or relative ("100b", "2h"),
+// a random delay of up to "jitter" (same format as a TTL) is added on top
+func ParseSchedule(at string, jitter string, height uint64) (s Schedule, err error) {
+
+	at = strings.TrimSpace(at)
+	j, err := ParseTTL(jitter)
+	if err != nil {
+		return s, fmt.Errorf("invalid jitter: %s", jitter)
+	}
+	if at == "" && j.IsZero() {
+		return s, nil
+	}
+
+	if h, err := strconv.ParseUint(at, 10, 64); err == nil {
+		if h <= height {
+			return s, fmt.Errorf("height %d has already been reached", h)
+		}
+		s.Height = h
+	} else if t, err := time.ParseInLocation(SCHEDULE_TIME_FORMAT, at, time.Local); err == nil {
+		if t.Before(time.Now()) {
+			return s, fmt.Errorf("%s is in the past", at)
+		}
+		s.Time = t
+	} else if r, err := ParseTTL(at); err != nil {
+		return s, fmt.Errorf("invalid send time: %s", at)
+	} else if r.Blocks > 0 {
+		s.Height = height + r.Blocks
+	} else {
+		// an empty time means now, only the jitter applies
+		s.Time = time.Now().Add(r.Duration)
+	}
+
+	// the jitter is converted to the unit of the target
+	if s.Height > 0 {
+		blocks := j.Blocks + uint64(j.Duration/BLOCK_TIME)
+		s.Height += random_below(blocks + 1)
+	} else {
+		d := j.Duration + time.Duration(j.Blocks)*BLOCK_TIME
+		s.Time = s.Time.Add(time.Duration(random_below(uint64(d/time.Second)+1)) * time.Second)
+	}
+
+	return s, nil
+}
+
+func random_below(n uint64) uint64 {
+
+	if n <= 1 {
+		return 0
+	}
+	r, err := rand.Int(rand.Reader, new(big.Int).SetUint64(n))
+	if err != nil {
+		return 0
+	}
+
+	return r.Uint64()
+}
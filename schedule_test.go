@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+
+	const height = 1000
+
+	if s, err := ParseSchedule("", "", height); err != nil || !s.IsZero() {
+		t.Errorf("empty schedule: %v, %v", s, err)
+	}
+
+	future := time.Now().Add(2 * time.Hour).Truncate(time.Minute)
+	tests := []struct {
+		name    string
+		at      string
+		jitter  string
+		invalid bool
+		min     Schedule
+		max     Schedule
+	}{
+		{name: "height", at: "1500", min: Schedule{Height: 1500}, max: Schedule{Height: 1500}},
+		{name: "relative blocks", at: "100b", min: Schedule{Height: 1100}, max: Schedule{Height: 1100}},
+		{name: "time", at: future.Format(SCHEDULE_TIME_FORMAT), min: Schedule{Time: future}, max: Schedule{Time: future}},
+		{name: "relative time", at: "1h", min: Schedule{Time: time.Now().Add(time.Hour)}, max: Schedule{Time: time.Now().Add(time.Hour + time.Minute)}},
+		// the jitter is converted to the unit of the target, 1h = 200 blocks
+		{name: "time jitter on a height", at: "1500", jitter: "1h", min: Schedule{Height: 1500}, max: Schedule{Height: 1700}},
+		{name: "block jitter on a time", at: future.Format(SCHEDULE_TIME_FORMAT), jitter: "10b", min: Schedule{Time: future}, max: Schedule{Time: future.Add(10 * BLOCK_TIME)}},
+		// no send time, only the jitter delays it
+		{name: "only jitter", jitter: "10m", min: Schedule{Time: time.Now()}, max: Schedule{Time: time.Now().Add(11 * time.Minute)}},
+		{name: "reached height", at: "1000", invalid: true},
+		{name: "past time", at: time.Now().Add(-time.Hour).Format(SCHEDULE_TIME_FORMAT), invalid: true},
+		{name: "invalid time", at: "tomorrow", invalid: true},
+		{name: "invalid jitter", at: "1500", jitter: "a while", invalid: true},
+	}
+
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.at, tt.jitter, height)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("%s: accepted as %s", tt.name, s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if s.Height < tt.min.Height || s.Height > tt.max.Height || s.Time.Before(tt.min.Time) || s.Time.After(tt.max.Time) {
+			t.Errorf("%s: got %s, want between %s and %s", tt.name, s, tt.min, tt.max)
+		}
+	}
+}
+
+func TestScheduleDue(t *testing.T) {
+
+	if s := (Schedule{Height: 100}); s.Due(99) || !s.Due(100) || !s.Due(101) {
+		t.Error("height schedule")
+	}
+	if s := (Schedule{Time: time.Now().Add(time.Minute)}); s.Due(0) {
+		t.Error("future time is due")
+	}
+	if s := (Schedule{Time: time.Now().Add(-time.Second)}); !s.Due(0) {
+		t.Error("past time isn't due")
+	}
+	if !(Schedule{}).Due(0) {
+		t.Error("empty schedule isn't due")
+	}
+}
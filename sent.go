@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const SENT_FILE = "sent.json"
+
+const (
+	SENT_PENDING   = "pending"
+	SENT_CONFIRMED = "confirmed"
+	SENT_DROPPED   = "dropped"
+)
+
+// outgoing message, the symmetric key allows to read it from the chain
+type MsgSent struct {
+	TXID      string   `json:"txid"`
+	SCID      string   `json:"scid"`
+	Key       string   `json:"key"`
+	Receivers []string `json:"receivers"`
+	Time      string   `json:"time"`
+	Status    string   `json:"status"`
+	Block     uint64   `json:"block,omitempty"` // topoheight
+	Message   string   `json:"-"`
+}
+
+var sent_messages []MsgSent
+
+func AddSent(scid string, txid string, key [32]byte, receivers []string) error {
+
+	if txid == "" {
+		return fmt.Errorf("empty TXID")
+	}
+
+	s := MsgSent{
+		TXID:      txid,
+		SCID:      scid,
+		Key:       hex.EncodeToString(key[:]),
+		Receivers: receivers,
+		Time:      time.Now().Format(time.DateTime),
+		Status:    SENT_PENDING,
+	}
+
+	// the key is unique per envelope, an envelope sent again replaces its entry
+	db_mu.Lock()
+	if i := slices.IndexFunc(sent_messages, func(m MsgSent) bool { return m.Key == s.Key }); i >= 0 {
+		sent_messages[i] = s
+	} else {
+		sent_messages = append(sent_messages, s)
+	}
+	db_mu.Unlock()
+
+	return DB_Save()
+}
+
+// copy of the sent messages
+func SentMessages() []MsgSent {
+
+	db_mu.Lock()
+	defer db_mu.Unlock()
+
+	return slices.Clone(sent_messages)
+}
+
+// check delivery status and read confirmed messages from the chain
+func SentUpdateStatus() (err error) {
+
+	// entries are only appended, the index stays valid while the lock is released
+	for i, s := range SentMessages() {
+		if s.Status == SENT_CONFIRMED && s.Message != "" {
+			continue
+		}
+
+		tx, err := GetTransaction(s.TXID)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case tx.In_pool:
+			s.Status = SENT_PENDING
+		case tx.Block_Height > 0 && tx.ValidBlock != "":
+			s.Status = SENT_CONFIRMED
+			s.Block = uint64(tx.Block_Height)
+			s.Message, _ = SentReadMessage(s)
+		default:
+			s.Status = SENT_DROPPED
+		}
+
+		db_mu.Lock()
+		sent_messages[i] = s
+		db_mu.Unlock()
+	}
+
+	return DB_Save()
+}
+
+// find and decrypt our message in the SC snapshot of its block
+func SentReadMessage(s MsgSent) (string, error) {
+
+	var key [32]byte
+	if k, err := hex.DecodeString(s.Key); err != nil || len(k) != 32 {
+		return "", fmt.Errorf("invalid key")
+	} else {
+		copy(key[:], k)
+	}
+
+	r, err := SC_GetSnapshot(s.SCID, s.Block)
+	if err != nil {
+		return "", err
+	}
+	if !SC_SanityCheck(r) {
+		return "", fmt.Errorf("SC sanity check failed")
+	}
+	plain, err := hex.DecodeString(r.ValuesString[2])
+	if err != nil {
+		return "", err
+	}
+
+	for _, m := range GetMessages(string(plain)) {
+		if !SanityCheck(m) {
+			continue
+		}
+		_, payload := GetPQ(GetPayload(m))
+		msg_hex, err := PayloadCheck(payload)
+		if err != nil {
+			continue
+		}
+		if decrypted, err := DecryptMessageWithKey(key, msg_hex); err == nil && HasIdentifier(string(decrypted)) {
+			_, content := GetTTL(string(decrypted))
+			return content, nil
+		}
+	}
+
+	return "", fmt.Errorf("message not found")
+}
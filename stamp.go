@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math/bits"
+	"strings"
+)
+
+// hashcash stamp at the end of an envelope: "p" + hex of the block height it was made at
+// and a nonce. The work covers the envelope, the contract and the height; receivers only
+// accept stamps of recent heights, so one stamp can't be used to post an envelope forever
+const STAMP_SEPARATOR = "p"
+const STAMP_NONCE_SIZE = 8
+const STAMP_SIZE = 8 + STAMP_NONCE_SIZE
+
+// blocks between the stamp's height and the block that stores the envelope (about a day)
+const STAMP_MAX_AGE = 4800
+
+// every bit doubles the work, 32 bits take about 4 billion hashes
+const STAMP_MAX_BITS = 32
+
+// split envelope and stamp, the nonce is nil without a valid stamp
+func GetStamp(envelope string) (body string, height uint64, nonce []byte) {
+
+	i := strings.LastIndex(envelope, STAMP_SEPARATOR)
+	if i < 0 {
+		return envelope, 0, nil
+	}
+	stamp, err := hex.DecodeString(envelope[i+1:])
+	if err != nil || len(stamp) != STAMP_SIZE {
+		return envelope, 0, nil
+	}
+
+	return envelope[:i], binary.BigEndian.Uint64(stamp[:8]), stamp[8:]
+}
+
+// sha256(body) with the contract and height the stamp is bound to
+func stamp_digest(body string, scid string, height uint64) [32]byte {
+
+	h := sha256.Sum256([]byte(body))
+	data := append(h[:], scid...)
+
+	return sha256.Sum256(binary.BigEndian.AppendUint64(data, height))
+}
+
+// leading zero bits of sha256(digest || nonce)
+func stamp_bits(digest [32]byte, nonce []byte) int {
+
+	h := sha256.Sum256(append(digest[:], nonce...))
+	zeros := 0
+	for _, b := range h {
+		zeros += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+
+	return zeros
+}
+
+// difficulty of an envelope's stamp for the contract and block height that store it,
+// 0 without a stamp or if it's too old. Only hashing, no curve operations
+func StampDifficulty(envelope string, scid string, height uint64) int {
+
+	body, made, nonce := GetStamp(envelope)
+	if nonce == nil || made > height || height-made > STAMP_MAX_AGE {
+		return 0
+	}
+
+	return stamp_bits(stamp_digest(body, scid, made), nonce)
+}
+
+// difficulty in bits that is searched for, at most STAMP_MAX_BITS
+func StampTarget(difficulty int) int {
+	return min(max(difficulty, 0), STAMP_MAX_BITS)
+}
+
+// search a nonce with the given difficulty for the contract and the current height,
+// an existing stamp is replaced. Can take long, not to be called on the UI thread
+func AddStamp(envelope string, scid string, height uint64, difficulty int) string {
+
+	envelope, _, _ = GetStamp(envelope)
+	difficulty = StampTarget(difficulty)
+	if difficulty == 0 {
+		return envelope
+	}
+
+	digest := stamp_digest(envelope, scid, height)
+	stamp := binary.BigEndian.AppendUint64(nil, height)
+	nonce := make([]byte, STAMP_NONCE_SIZE)
+	for n := uint64(0); ; n++ {
+		binary.BigEndian.PutUint64(nonce, n)
+		if stamp_bits(digest, nonce) >= difficulty {
+			return envelope + STAMP_SEPARATOR + hex.EncodeToString(append(stamp, nonce...))
+		}
+	}
+}
+
+// stamp again if the stamp doesn't reach our difficulty for this contract and height
+func RenewStamp(envelope string, scid string, height uint64) string {
+
+	if SC_Config.Stamp <= 0 || StampDifficulty(envelope, scid, height) >= StampTarget(SC_Config.Stamp) {
+		return envelope
+	}
+
+	return AddStamp(envelope, scid, height, SC_Config.Stamp)
+}
+
+// receivers skip envelopes below their minimum difficulty
+func StampCheck(envelope string, scid string, height uint64) bool {
+	return SC_Config.MinStamp <= 0 || StampDifficulty(envelope, scid, height) >= SC_Config.MinStamp
+}
+
+// envelopes of a block that pass StampCheck, joined again
+func StampFilter(data string, scid string, height uint64) string {
+
+	if SC_Config.MinStamp <= 0 {
+		return data
+	}
+
+	var kept []string
+	for _, m := range GetMessages(data) {
+		if StampCheck(m, scid, height) {
+			kept = append(kept, m)
+		}
+	}
+
+	return strings.Join(kept, "+")
+}
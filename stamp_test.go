@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetStamp(t *testing.T) {
+
+	body, height, nonce := GetStamp("abcp" + "00000000000003e8" + "0102030405060708")
+	if body != "abc" || height != 1000 || len(nonce) != STAMP_NONCE_SIZE {
+		t.Errorf("parsed %q %d %x", body, height, nonce)
+	}
+
+	for _, envelope := range []string{"abc", "abcp0102", "abcp" + strings.Repeat("zz", STAMP_SIZE)} {
+		if body, _, nonce := GetStamp(envelope); body != envelope || nonce != nil {
+			t.Errorf("%q: parsed %q %x", envelope, body, nonce)
+		}
+	}
+}
+
+func TestStampDifficulty(t *testing.T) {
+
+	const height = 10000
+	envelope := AddStamp("abcdef", TEST_SCID_A, height, 8)
+
+	if d := StampDifficulty("abcdef", TEST_SCID_A, height); d != 0 {
+		t.Errorf("no stamp: %d bits", d)
+	}
+
+	tests := []struct {
+		name   string
+		scid   string
+		height uint64
+		valid  bool
+	}{
+		{name: "same block", scid: TEST_SCID_A, height: height, valid: true},
+		{name: "recent block", scid: TEST_SCID_A, height: height + STAMP_MAX_AGE, valid: true},
+		{name: "other contract", scid: TEST_SCID_B, height: height},
+		{name: "too old", scid: TEST_SCID_A, height: height + STAMP_MAX_AGE + 1},
+		{name: "future height", scid: TEST_SCID_A, height: height - 1},
+	}
+	for _, tt := range tests {
+		if d := StampDifficulty(envelope, tt.scid, tt.height); tt.valid != (d >= 8) {
+			t.Errorf("%s: %d bits", tt.name, d)
+		}
+	}
+
+	// a new stamp replaces the old one
+	restamped := AddStamp(envelope, TEST_SCID_A, height+100, 8)
+	if body, made, _ := GetStamp(restamped); body != "abcdef" || made != height+100 {
+		t.Errorf("restamped %q", restamped)
+	}
+	if d := StampDifficulty(restamped, TEST_SCID_A, height+100); d < 8 {
+		t.Errorf("restamped: %d bits", d)
+	}
+}
+
+func TestRenewStamp(t *testing.T) {
+
+	defer func(s int) { SC_Config.Stamp = s }(SC_Config.Stamp)
+	SC_Config.Stamp = 4
+
+	envelope := RenewStamp("abcdef", TEST_SCID_A, 100)
+	if StampDifficulty(envelope, TEST_SCID_A, 100) < 4 {
+		t.Fatalf("not stamped: %q", envelope)
+	}
+	if RenewStamp(envelope, TEST_SCID_A, 200) != envelope {
+		t.Error("valid stamp renewed")
+	}
+	if renewed := RenewStamp(envelope, TEST_SCID_A, 100+STAMP_MAX_AGE+1); StampDifficulty(renewed, TEST_SCID_A, 100+STAMP_MAX_AGE+1) < 4 {
+		t.Error("expired stamp not renewed")
+	}
+
+	SC_Config.Stamp = 0
+	if RenewStamp("abcdef", TEST_SCID_A, 100) != "abcdef" {
+		t.Error("stamped without pow_stamp")
+	}
+}
+
+func TestStampTarget(t *testing.T) {
+
+	// a difficulty above the maximum would never be found
+	for difficulty, want := range map[int]int{-1: 0, 0: 0, 20: 20, STAMP_MAX_BITS: STAMP_MAX_BITS, 257: STAMP_MAX_BITS} {
+		if got := StampTarget(difficulty); got != want {
+			t.Errorf("%d bits: %d, want %d", difficulty, got, want)
+		}
+	}
+}
+
+func TestStampFilter(t *testing.T) {
+
+	defer func(s int) { SC_Config.MinStamp = s }(SC_Config.MinStamp)
+
+	stamped := AddStamp("abc", TEST_SCID_A, 100, 8)
+	data := stamped + "+def+" + AddStamp("ghi", TEST_SCID_B, 100, 8)
+
+	SC_Config.MinStamp = 0
+	if got := StampFilter(data, TEST_SCID_A, 100+STAMP_MAX_AGE+1); got != data {
+		t.Errorf("filtered without min_pow: %q", got)
+	}
+
+	SC_Config.MinStamp = 8
+	if got := StampFilter(data, TEST_SCID_A, 100); got != stamped {
+		t.Errorf("filtered %q, want %q", got, stamped)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// history between LastUpdate and Top that wasn't scanned yet, left by a cancelled sync
+type SyncGap struct {
+	Height  uint64 `json:"height"` // next height to fetch
+	Top     uint64 `json:"top"`
+	TopPrev uint64 `json:"top_prev"`
+}
+
+type SyncProgress struct {
+	Contract  string
+	Scanned   uint64
+	Remaining uint64
+	Messages  int64
+}
+
+// SC data of one height, to be processed by a sync worker
+type SyncJob struct {
+	SCID   string
+	Height uint64
+	Msg    string
+}
+
+type SyncResult struct {
+	Height   uint64
+	Hash     string
+	Messages []MsgDecryped
+}
+
+var sync_gap *SyncGap
+
+// held by a running sync and by everything that changes the sync state or the
+// keys it decrypts with (rescans, channels, contracts)
+var sync_mu sync.Mutex
+
+var ErrSyncRunning = errors.New("a sync is running, try again when it's done")
+
+// fetch new messages, stops at ctx cancellation and keeps what was found so far
+func SC_SyncLoop(ctx context.Context, progress func(SyncProgress)) (int, error) {
+
+	sync_mu.Lock()
+	defer sync_mu.Unlock()
+
+	RefreshHeight()
+	PurgeExpired()
+
+	// headers above the stable height may have changed since the last sync
+	if w, err := CurrentWalker(); err != nil {
+		return 0, err
+	} else if err = w.Refresh(); err != nil {
+		return 0, err
+	} else {
+		w.Prune(int64(stable_height.Load()))
+	}
+
+	var msg_count int
+	for _, c := range SC_Config.Contracts {
+		SC_Select(c.SCID)
+
+		count, err := SC_SyncContract(ctx, progress)
+		msg_count += count
+		if err != nil {
+			return msg_count, fmt.Errorf("%s: %w", c.Name, err)
+		}
+	}
+
+	count, err := PayloadSync()
+	msg_count += count
+	if err != nil {
+		return msg_count, fmt.Errorf("TX payloads: %w", err)
+	}
+
+	return msg_count, nil
+}
+
+// sync the selected contract
+func SC_SyncContract(ctx context.Context, progress func(SyncProgress)) (int, error) {
+
+	if from, err := SC_CheckReorg(ctx); err != nil {
+		return 0, err
+	} else if from > 0 {
+		log_xswd.Println("Chain reorganization detected, rescanning from height", from)
+		if err = SC_Rescan(from); err != nil {
+			return 0, err
+		}
+	}
+
+	var msg_count int
+
+	// finish an interrupted sync first
+	if sync_gap != nil {
+		if err := SC_Request(sync_gap.Height); err != nil {
+			return 0, err
+		}
+		next, count, err := SC_Walk(ctx, sync_gap.Top, progress)
+		msg_count += count
+		if err != nil {
+			sync_gap.Height = next
+			SC_Save()
+			return msg_count, err
+		}
+		SC_Data.LastUpdate, SC_Data.LastPrev = sync_gap.Top, sync_gap.TopPrev
+		sync_gap = nil
+	}
+
+	if err := SC_Request(0); err != nil {
+		return msg_count, err
+	}
+
+	current_height, current_prev := SC_Data.Height, SC_Data.Prev
+
+	if SC_Data.Height > SC_Data.LastUpdate {
+		next, count, err := SC_Walk(ctx, current_height, progress)
+		msg_count += count
+		if err != nil {
+			sync_gap = &SyncGap{
+				Height:  next,
+				Top:     current_height,
+				TopPrev: current_prev,
+			}
+			SC_Save()
+			return msg_count, err
+		}
+		SC_Data.LastUpdate, SC_Data.LastPrev = current_height, current_prev
+	}
+	SC_RecordHash(chain_height.Load())
+
+	if err := SC_Save(); err != nil {
+		log_xswd.Println("Can't save database:", err)
+	}
+
+	return msg_count, nil
+}
+
+// walk the prev chain from the loaded snapshot down to LastUpdate, returns the
+// height to continue from if the walk is interrupted
+func SC_Walk(ctx context.Context, top uint64, progress func(SyncProgress)) (next uint64, msg_count int, err error) {
+
+	// the ML-KEM key is derived before the workers share it
+	if _, err = MLKEMKey(); err != nil {
+		return SC_Data.Height, 0, fmt.Errorf("ML-KEM key: %w", err)
+	}
+
+	// the prev chain is walked in order, decryption and block headers are
+	// fetched by workers while the next snapshot is requested
+	jobs := make(chan SyncJob)
+	results := make(chan SyncResult)
+	var found atomic.Int64
+
+	var wg sync.WaitGroup
+	for range max(SC_Config.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				r := SC_SyncWorker(j)
+				found.Add(int64(len(r.Messages)))
+				results <- r
+			}
+		}()
+	}
+
+	var collected []SyncResult
+	done := make(chan struct{})
+	go func() {
+		for r := range results {
+			collected = append(collected, r)
+		}
+		close(done)
+	}()
+
+	for {
+		jobs <- SyncJob{SCID: sc_active, Height: SC_Data.Height, Msg: SC_Data.Msg}
+		next = SC_Data.Prev
+
+		if progress != nil {
+			progress(SyncProgress{
+				Contract:  ContractName(sc_active),
+				Scanned:   top - min(top, SC_Data.Height),
+				Remaining: SC_Data.Height - min(SC_Data.Height, SC_Data.LastUpdate),
+				Messages:  found.Load(),
+			})
+		}
+
+		if SC_Data.Height == SC_Data.Prev || SC_Data.Prev <= SC_Data.LastUpdate {
+			break
+		}
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		if err = SC_Request(SC_Data.Prev); err != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	close(results)
+	<-done
+
+	for _, r := range collected {
+		for _, m := range r.Messages {
+			if AddMessage(m) {
+				msg_count++
+			}
+		}
+		if r.Hash != "" {
+			block_hashes[r.Height] = r.Hash
+		}
+	}
+
+	return next, msg_count, err
+}
+
+func SC_SyncWorker(j SyncJob) (r SyncResult) {
+
+	r.Height = j.Height
+
+	plain, err := hex.DecodeString(j.Msg)
+	if err != nil {
+		plain = nil
+	}
+	// cheap check before any curve operation
+	contents := DecryptMessages(StampFilter(string(plain), j.SCID, j.Height))
+
+	h, err := GetBlockHeader(j.Height)
+	if err != nil {
+		log_xswd.Println("Can't get block header:", err)
+	} else {
+		r.Hash = h.Hash
+	}
+
+	if len(contents) == 0 {
+		return
+	}
+
+	ts := "#no timestamp"
+	var bt time.Time
+	if err == nil {
+		bt = time.UnixMilli(int64(h.Timestamp))
+		ts = bt.Format(time.DateTime)
+	}
+	for _, m := range contents {
+		if m.Message == "" {
+			continue
+		}
+		m.SCID = j.SCID
+		m.Block = j.Height
+		m.Time = ts
+		SetExpiry(&m, bt)
+		if m.Expired() {
+			continue
+		}
+		r.Messages = append(r.Messages, m)
+	}
+
+	return
+}
@@ -1,20 +1,27 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/data/binding"
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 )
 
-func CreateWindow() fyne.Window {
+func CreateWindow(warnings []string) fyne.Window {
 
 	myApp := app.New()
 	myApp.Settings().SetTheme(theme.DarkTheme())
@@ -28,14 +35,56 @@ func CreateWindow() fyne.Window {
 	in_message := widget.NewMultiLineEntry()
 	in_message.SetMinRowsVisible(5)
 
+	in_ttl := widget.NewEntry()
+	in_ttl.SetPlaceHolder("optional, e.g. 100b (blocks) or 2h")
+
+	// scheduled sending
+	in_at := widget.NewEntry()
+	in_at.SetPlaceHolder("optional, height, 2006-01-02 15:04 or 100b/2h from now")
+	in_jitter := widget.NewEntry()
+	in_jitter.SetPlaceHolder("optional, e.g. 10b or 30m")
+
 	// output fields
 	output := widget.NewEntry()
 
 	// ringsize dropdown
-	rs_options := []string{"2", "4", "8", "16", "32", "64"}
+	rs_options := []string{"2", "4", "8", "16", "32", "64", "128"}
 	ringsize := widget.NewSelect(rs_options, nil)
 	ringsize.SetSelectedIndex(3)
 
+	// target contract
+	target := widget.NewSelect(ContractNames(), nil)
+	target.SetSelectedIndex(0)
+
+	// hybrid post-quantum mode
+	hybrid := widget.NewCheck("Post-quantum", nil)
+
+	// short messages can go into TX payloads instead of the SC
+	transport := widget.NewSelect([]string{TRANSPORT_SC, TRANSPORT_PAYLOAD}, func(s string) {
+		if s == TRANSPORT_PAYLOAD {
+			target.Disable()
+			hybrid.Disable()
+		} else {
+			target.Enable()
+			hybrid.Enable()
+		}
+		output.SetText("")
+	})
+	transport.SetSelectedIndex(0)
+
+	// key and receivers of the last generated output, dropped once the output is edited
+	var out_key [32]byte
+	var out_receivers []string
+	var out_envelope string
+	var out_mu sync.Mutex // the stamp is computed in the background
+	output.OnChanged = func(s string) {
+		out_mu.Lock()
+		if s != out_envelope {
+			out_key, out_receivers, out_envelope = [32]byte{}, nil, ""
+		}
+		out_mu.Unlock()
+	}
+
 	// buttons
 	button := widget.NewButton("Generate output", func() {
 
@@ -55,6 +104,27 @@ func CreateWindow() fyne.Window {
 			output.FocusGained()
 			return
 		}
+		ttl, err := ParseTTL(in_ttl.Text)
+		if err != nil {
+			output.SetText(err.Error())
+			output.FocusGained()
+			return
+		}
+
+		// the wallet encrypts payloads for each receiver
+		if transport.Selected == TRANSPORT_PAYLOAD {
+			msg := AddTTL(in_message.Text, ttl)
+			if _, err := PayloadArguments(msg); err != nil {
+				output.SetText(err.Error())
+			} else {
+				out_mu.Lock()
+				out_receivers, out_envelope = addrs, msg
+				out_mu.Unlock()
+				output.SetText(msg)
+			}
+			output.FocusGained()
+			return
+		}
 
 		p, keys, key, err := GenerateSharedSecrets(addrs)
 		if err != nil {
@@ -65,71 +135,342 @@ func CreateWindow() fyne.Window {
 			for i := range keys {
 				key_string += keys[i]
 			}
-			enc, msg, err := EncryptMessage(in_message.Text, key)
+			var pq string
+			if hybrid.Checked {
+				if pq, key, err = HybridEncapsulate(addrs, key); err != nil {
+					output.SetText(err.Error())
+					output.FocusGained()
+					return
+				}
+				pq += PQ_SEPARATOR
+			}
+			enc, msg, err := EncryptMessage(AddTTL(in_message.Text, ttl), key)
 			if err != nil {
 				output.SetText(err.Error())
 			} else {
 				in_message.Text = msg
 				in_message.Refresh()
-				output.SetText(fmt.Sprintf("%s%sx%s", p, key_string, enc))
+				envelope := fmt.Sprintf("%s%sx%s%s", p, key_string, pq, enc)
+				var scid string
+				if c, ok := GetContractByName(target.Selected); ok {
+					scid = c.SCID
+				}
+
+				// the stamp is bound to the contract and the current height
+				if SC_Config.Stamp > 0 {
+					output.SetText("Computing proof-of-work stamp...")
+				}
+				go func() {
+					if SC_Config.Stamp > 0 {
+						if h, err := GetHeight(); err == nil {
+							envelope = AddStamp(envelope, scid, h.Height, SC_Config.Stamp)
+						}
+					}
+					out_mu.Lock()
+					out_envelope, out_key, out_receivers = envelope, key, addrs
+					out_mu.Unlock()
+					output.SetText(envelope)
+				}()
 			}
 		}
 		output.FocusGained()
 	})
-	button2 := widget.NewButton("Send to SC", func() {
+	button2 := widget.NewButton("Send", nil)
+	button2.OnTapped = func() {
 		output.FocusLost()
-		if len(output.Text) >= MSG_MIN_LENGTH {
-			if _, err := SC_SendMessage(output.Text, ringsize.Selected); err == nil {
-				// TODO: Transfer response is empty
-				//output.Text = fmt.Sprintf("TXID: %s", txid)
-				output.Text = "Transaction sent!"
-			} else {
-				output.Text = fmt.Sprintf("Error: %s", err.Error())
+		out_mu.Lock()
+		send_key, send_receivers := out_key, out_receivers
+		out_mu.Unlock()
+		if transport.Selected == TRANSPORT_PAYLOAD && output.Text != "" {
+			if send_receivers == nil {
+				output.SetText("output was edited, click on Generate output again")
+				return
+			}
+			if in_at.Text != "" || in_jitter.Text != "" {
+				output.SetText("scheduled sending is only available for SC messages")
+				return
+			}
+			t, fees, err := PayloadPrepareMessage(send_receivers, output.Text, ringsize.Selected)
+			if err != nil {
+				output.SetText(fmt.Sprintf("Error: %s", err.Error()))
+				return
 			}
-			output.Refresh()
-			output.FocusGained()
-		}
-	})
 
-	button3 := widget.NewButton("Check for messages", func() {
-		count, _ := SC_SyncLoop()
+			preview, err := NewSendPreview(output.Text, t, fees)
+			if err != nil {
+				output.SetText(fmt.Sprintf("Error: %s", err.Error()))
+				return
+			}
 
-		if count > 0 {
-			newMessagesContent := widget.NewLabel(fmt.Sprintf("Found %d message(s)!", count))
-			dialog.ShowCustom("New Message", "Got it!", newMessagesContent, myWindow)
-		} else {
-			dialog.ShowInformation("Message", "No new message", myWindow)
+			dialog.ShowConfirm("Send message", preview.String(), func(ok bool) {
+				if !ok {
+					return
+				}
+				button2.Disable()
+				output.SetText("Sending...")
+				go func() {
+					if txid, err := SC_Transfer(t); err == nil {
+						output.SetText(fmt.Sprintf("TXID: %s", txid))
+					} else {
+						output.SetText(fmt.Sprintf("Error: %s", err.Error()))
+					}
+					button2.Enable()
+				}()
+			}, myWindow)
+		} else if len(output.Text) >= MSG_MIN_LENGTH {
+			c, ok := GetContractByName(target.Selected)
+			if !ok {
+				output.SetText("no contract selected")
+				return
+			}
+			h, err := GetHeight()
+			if err != nil {
+				output.SetText(fmt.Sprintf("Error: %s", err.Error()))
+				return
+			}
+			schedule, err := ParseSchedule(in_at.Text, in_jitter.Text, h.Height)
+			if err != nil {
+				output.SetText(fmt.Sprintf("Error: %s", err.Error()))
+				return
+			}
+			t, fees, err := SC_PrepareMessage(c.SCID, output.Text, ringsize.Selected)
+			if err != nil {
+				output.SetText(fmt.Sprintf("Error: %s", err.Error()))
+				return
+			}
+
+			preview, err := NewSendPreview(output.Text, t, fees)
+			if err != nil {
+				output.SetText(fmt.Sprintf("Error: %s", err.Error()))
+				return
+			}
+
+			text := preview.String()
+			if !schedule.IsZero() {
+				text += fmt.Sprintf("\n\nScheduled for %s, dShout has to be running then", schedule)
+			}
+
+			// costs are shown before the wallet signs
+			dialog.ShowConfirm("Send message", text, func(ok bool) {
+				if !ok {
+					return
+				}
+				if !schedule.IsZero() {
+					if _, err := OutboxAdd(c.SCID, output.Text, ringsize.Selected, send_key, send_receivers, schedule); err != nil {
+						log_xswd.Println("Can't store outbox entry:", err)
+					}
+					output.SetText(fmt.Sprintf("Scheduled for %s (outbox)", schedule))
+					return
+				}
+
+				// the wallet may wait for the user, the envelope stays in the outbox if sending fails
+				envelope, selected := output.Text, ringsize.Selected
+				button2.Disable()
+				output.SetText("Sending...")
+				go func() {
+					if txid, err := OutboxPost(c.SCID, envelope, selected, send_key, send_receivers); err == nil {
+						output.SetText(fmt.Sprintf("TXID: %s", txid))
+					} else {
+						output.SetText(fmt.Sprintf("Error: %s (kept in the outbox)", err.Error()))
+					}
+					button2.Enable()
+				}()
+			}, myWindow)
 		}
+	}
+
+	button3 := widget.NewButton("Check for messages", nil)
+	button3.OnTapped = func() {
+		button3.Disable()
+
+		// sync runs in the background, the dialog shows its progress
+		ctx, cancel := context.WithCancel(context.Background())
+		bar := widget.NewProgressBar()
+		status := widget.NewLabel("Checking for reorganizations...")
+		progress := dialog.NewCustomWithoutButtons("Checking for messages", container.NewVBox(
+			bar,
+			status,
+			widget.NewButton("Cancel", cancel),
+		), myWindow)
+		progress.Show()
+
+		go func() {
+			count, err := SC_SyncLoop(ctx, func(p SyncProgress) {
+				if total := p.Scanned + p.Remaining; total > 0 {
+					bar.SetValue(float64(p.Scanned) / float64(total))
+				}
+				status.SetText(fmt.Sprintf("%s: %d heights scanned, %d remaining, %d message(s) found", p.Contract, p.Scanned, p.Remaining, p.Messages))
+			})
+			cancel()
+			progress.Hide()
+			button3.Enable()
+
+			switch {
+			case errors.Is(err, context.Canceled):
+				dialog.ShowInformation("Message", fmt.Sprintf("Check cancelled, %d new message(s) so far.\nThe next check continues where it stopped.", count), myWindow)
+			case err != nil:
+				dialog.ShowError(err, myWindow)
+			case count > 0:
+				newMessagesContent := widget.NewLabel(fmt.Sprintf("Found %d message(s)!", count))
+				dialog.ShowCustom("New Message", "Got it!", newMessagesContent, myWindow)
+			default:
+				dialog.ShowInformation("Message", "No new message", myWindow)
+			}
+		}()
+	}
+	button5 := widget.NewButton("Channels", func() {
+		ChannelWindow(myApp)
+	})
+	button6 := widget.NewButton("Sent", func() {
+		SentWindow(myApp)
 	})
 	button4 := widget.NewButton("Show messages", func() {
-		if len(decrypted_messages) > 0 {
+		PurgeExpired()
+		if len(Messages()) > 0 {
 			MessageWindow(myApp)
 		}
 	})
 
+	// menu
+	myWindow.SetMainMenu(fyne.NewMainMenu(
+		fyne.NewMenu("Tools",
+			fyne.NewMenuItem("Contracts", func() {
+				ContractWindow(myApp, func() {
+					target.Options = ContractNames()
+					target.SetSelectedIndex(0)
+					if read_only.Load() {
+						button2.Disable()
+					} else {
+						button2.Enable()
+					}
+				})
+			}),
+			fyne.NewMenuItem("Outbox", func() {
+				OutboxWindow(myApp)
+			}),
+			fyne.NewMenuItem("Contacts", func() {
+				ContactWindow(myApp)
+			}),
+			fyne.NewMenuItem("Rescan from height", func() {
+				height := widget.NewEntry()
+				height.SetPlaceHolder("0 = full rescan")
+				dialog.ShowForm("Rescan", "Rescan", "Cancel", []*widget.FormItem{
+					widget.NewFormItem("Height", height),
+				}, func(ok bool) {
+					if !ok {
+						return
+					}
+					h, err := strconv.ParseUint(height.Text, 10, 64)
+					if err != nil {
+						dialog.ShowError(err, myWindow)
+						return
+					}
+					if err = SC_RescanAll(h); err != nil {
+						dialog.ShowError(err, myWindow)
+						return
+					}
+					dialog.ShowInformation("Rescan", "Click on \"Check for messages\" to start the rescan", myWindow)
+				}, myWindow)
+			}),
+			fyne.NewMenuItem("Cover traffic", func() {
+				dialog.ShowInformation("Cover traffic", CoverStatus(), myWindow)
+			}),
+			fyne.NewMenuItem("Daemon report", func() {
+				reports := QuorumReports()
+				if len(daemons) == 0 {
+					dialog.ShowInformation("Daemon report", "No daemons configured for cross-checking", myWindow)
+					return
+				} else if len(reports) == 0 {
+					dialog.ShowInformation("Daemon report", "All daemons agree", myWindow)
+					return
+				}
+				report := widget.NewMultiLineEntry()
+				report.SetText(strings.Join(reports, "\n"))
+				report.SetMinRowsVisible(10)
+				dialog.ShowCustom("Daemon report", "Close", report, myWindow)
+			}),
+			fyne.NewMenuItemSeparator(),
+			fyne.NewMenuItem("Publish ML-KEM key", func() {
+				if txid, err := SC_PublishMLKEMKey(); err != nil {
+					dialog.ShowError(err, myWindow)
+				} else {
+					dialog.ShowInformation("ML-KEM key", fmt.Sprintf("TXID: %s", txid), myWindow)
+				}
+			}),
+		),
+	))
+
 	// container
 	content := container.NewVBox(
 		widget.NewLabel("Receiver:"),
 		in_wallets,
 		widget.NewLabel("Message"),
 		in_message,
+		container.NewBorder(nil, nil, widget.NewLabel("Expiry"), nil, in_ttl),
+		container.NewGridWithColumns(2,
+			container.NewBorder(nil, nil, widget.NewLabel("Send at"), nil, in_at),
+			container.NewBorder(nil, nil, widget.NewLabel("Jitter"), nil, in_jitter),
+		),
 		widget.NewLabel("Output"),
 		output,
 		container.NewHBox(
 			button,
 			button2,
+			transport,
+			target,
 			ringsize,
+			hybrid,
 			layout.NewSpacer(),
 			button3,
 			button4,
+			button5,
+			button6,
 		),
 	)
 
-	myWindow.SetContent(content)
+	if read_only.Load() {
+		button2.Disable()
+	}
+	ready := func() {
+		myWindow.SetContent(content)
+		StartBackground()
+		if read_only.Load() {
+			dialog.ShowInformation("Read-only mode", ReadOnlyWarning(warnings), myWindow)
+		}
+	}
+
+	// nothing is usable before the database is unlocked
+	if SC_Config.Password {
+		myWindow.SetContent(container.NewCenter(widget.NewLabel("Database is locked")))
+		UnlockDialog(myWindow, ready)
+	} else {
+		ready()
+	}
 
 	return myWindow
 }
 
+// ask for the database passphrase until it can be opened
+func UnlockDialog(w fyne.Window, unlocked func()) {
+
+	passphrase := widget.NewPasswordEntry()
+	unlock := dialog.NewForm("Unlock database", "Unlock", "Quit", []*widget.FormItem{
+		widget.NewFormItem("Passphrase", passphrase),
+	}, func(ok bool) {
+		if !ok {
+			w.Close()
+			return
+		}
+		if err := DB_Open(passphrase.Text); err != nil {
+			dialog.ShowError(err, w)
+			UnlockDialog(w, unlocked)
+			return
+		}
+		unlocked()
+	}, w)
+	unlock.Show()
+}
+
 // new window wo view messages
 func MessageWindow(app fyne.App) {
 
@@ -137,35 +478,98 @@ func MessageWindow(app fyne.App) {
 	myMessageWindow.Resize(fyne.NewSize(600, 200))
 	myMessageWindow.SetFixedSize(true)
 
+	// bindings can be set from the countdown goroutine
+	text := binding.NewString()
+	countdown := binding.NewString()
 	message := widget.NewMultiLineEntry()
+	message.Bind(text)
 	message.SetMinRowsVisible(6)
 	block := widget.NewEntry()
+	expiry := widget.NewLabelWithData(countdown)
 
-	sort.Slice(decrypted_messages, func(i, j int) bool { return decrypted_messages[i].Block < decrypted_messages[j].Block })
-
-	message.Text = decrypted_messages[0].Message
-	block.Text = fmt.Sprintf("%d (%v)", decrypted_messages[0].Block, decrypted_messages[0].Time)
-	message.Refresh()
+	// the sync may add messages while the window is open
+	messages := Messages()
+	sort.Slice(messages, func(i, j int) bool { return messages[i].Block < messages[j].Block })
 
 	var pos int
+	var current atomic.Pointer[MsgDecryped]
+	update := func(m *MsgDecryped) {
+		if m.Expired() {
+			text.Set("")
+		} else {
+			text.Set(m.Message)
+		}
+		countdown.Set(m.Countdown())
+	}
+	show := func() {
+		if pos >= len(messages) {
+			return
+		}
+		m := messages[pos]
+		current.Store(&m)
+		block.SetText(MessageInfo(m))
+		update(&m)
+	}
+	show()
+
+	// countdown for expiring messages, block heights are refreshed once per block
+	done := make(chan bool)
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		last := time.Now()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				m := current.Load()
+				if m == nil || m.Countdown() == "" {
+					continue
+				}
+				if m.ExpireHeight > 0 && time.Since(last) >= BLOCK_TIME {
+					RefreshHeight()
+					last = time.Now()
+				}
+				update(m)
+			}
+		}
+	}()
+	myMessageWindow.SetOnClosed(func() { close(done) })
+
 	btn_prev := widget.NewButton("Prev", func() {
 		if pos > 0 {
 			pos--
-			message.Text = decrypted_messages[pos].Message
-			block.Text = fmt.Sprintf("%d (%v)", decrypted_messages[pos].Block, decrypted_messages[pos].Time)
-			message.Refresh()
-			block.Refresh()
+			show()
 		}
 	})
 	btn_next := widget.NewButton("Next", func() {
-		if pos < len(decrypted_messages)-1 {
+		if pos < len(messages)-1 {
 			pos++
-			message.Text = decrypted_messages[pos].Message
-			block.Text = fmt.Sprintf("%d (%v)", decrypted_messages[pos].Block, decrypted_messages[pos].Time)
-			message.Refresh()
-			block.Refresh()
+			show()
 		}
 	})
+	btn_export := widget.NewButton("Export proof", func() {
+		if pos >= len(messages) {
+			return
+		}
+		data, err := ExportDisclosure(messages[pos])
+		if err != nil {
+			dialog.ShowError(err, myMessageWindow)
+			return
+		}
+		save := dialog.NewFileSave(func(w fyne.URIWriteCloser, err error) {
+			if err != nil || w == nil {
+				return
+			}
+			defer w.Close()
+			if _, err = w.Write(data); err != nil {
+				dialog.ShowError(err, myMessageWindow)
+			}
+		}, myMessageWindow)
+		save.SetFileName(fmt.Sprintf("disclosure_%d.json", messages[pos].Block))
+		save.Show()
+	})
 	btn_close := widget.NewButton("Close", func() {
 		myMessageWindow.Close()
 	})
@@ -178,7 +582,9 @@ func MessageWindow(app fyne.App) {
 		container.NewHBox(
 			btn_prev,
 			btn_next,
+			btn_export,
 			layout.NewSpacer(),
+			expiry,
 			btn_close,
 		),
 	)
@@ -186,3 +592,445 @@ func MessageWindow(app fyne.App) {
 	myMessageWindow.SetContent(content)
 	myMessageWindow.Show()
 }
+
+func ReadOnlyWarning(warnings []string) string {
+	return "The code of these contracts doesn't match a known dShout version:\n\n" +
+		strings.Join(warnings, "\n") +
+		"\n\nMessages can be read, sending is disabled."
+}
+
+func MessageInfo(m MsgDecryped) string {
+	info := fmt.Sprintf("[%s] %d (%v)", ContractName(m.SCID), m.Block, m.Time)
+	if m.TXID != "" {
+		info = fmt.Sprintf("[payload] %d (%v)", m.Block, m.Time)
+		if m.Sender != "" {
+			info += " from " + m.Sender
+		}
+	}
+	if m.Channel != "" {
+		info += fmt.Sprintf(" %s%s", CHANNEL_PREFIX, m.Channel)
+	}
+	return info
+}
+
+// new window to manage contracts, changed is called after adding or removing one
+func ContractWindow(app fyne.App, changed func()) {
+
+	myContractWindow := app.NewWindow("dShout - Contracts")
+	myContractWindow.Resize(fyne.NewSize(600, 300))
+	myContractWindow.SetFixedSize(true)
+
+	selected := -1
+	list := widget.NewList(
+		func() int { return len(SC_Config.Contracts) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			c := SC_Config.Contracts[i]
+			o.(*widget.Label).SetText(fmt.Sprintf("%s  %s", c.Name, c.SCID))
+		},
+	)
+	list.OnSelected = func(id widget.ListItemID) { selected = id }
+	list.OnUnselected = func(id widget.ListItemID) { selected = -1 }
+
+	name := widget.NewEntry()
+	name.SetPlaceHolder("name")
+	scid := widget.NewEntry()
+	scid.SetPlaceHolder("SCID")
+
+	btn_add := widget.NewButton("Add", func() {
+		c := Contract{Name: name.Text, SCID: strings.TrimSpace(scid.Text)}
+		if err := AddContract(c.Name, c.SCID); err != nil {
+			dialog.ShowError(err, myContractWindow)
+			return
+		}
+		if err := SC_VerifyContract(c); err != nil {
+			dialog.ShowInformation("Read-only mode", ReadOnlyWarning([]string{err.Error()}), myContractWindow)
+		}
+		name.SetText("")
+		scid.SetText("")
+		list.Refresh()
+		changed()
+	})
+	btn_remove := widget.NewButton("Remove", func() {
+		if selected < 0 || selected >= len(SC_Config.Contracts) {
+			return
+		}
+		if err := RemoveContract(SC_Config.Contracts[selected].Name); err != nil {
+			dialog.ShowError(err, myContractWindow)
+			return
+		}
+		list.UnselectAll()
+		list.Refresh()
+		changed()
+	})
+	btn_deploy := widget.NewButton("Deploy new", func() {
+		deploy_name := widget.NewEntry()
+		dialog.ShowForm("Deploy new dShout contract", "Deploy", "Cancel", []*widget.FormItem{
+			widget.NewFormItem("Name", deploy_name),
+		}, func(ok bool) {
+			if !ok {
+				return
+			}
+
+			// installation needs a few blocks, the SCID is known after the transfer
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+			bar := widget.NewProgressBarInfinite()
+			waiting := dialog.NewCustomWithoutButtons("Deploying contract", container.NewVBox(
+				bar,
+				widget.NewLabel("Confirm the transaction in your wallet, then wait for the contract."),
+				widget.NewButton("Cancel", cancel),
+			), myContractWindow)
+			waiting.Show()
+
+			go func() {
+				scid, err := SC_DeployContract(ctx, deploy_name.Text)
+				cancel()
+				bar.Stop()
+				waiting.Hide()
+
+				switch {
+				case err != nil && scid != "":
+					dialog.ShowError(fmt.Errorf("%s\nSCID: %s", err, scid), myContractWindow)
+				case err != nil:
+					dialog.ShowError(err, myContractWindow)
+				default:
+					dialog.ShowInformation("Contract deployed", fmt.Sprintf("SCID: %s", scid), myContractWindow)
+					list.Refresh()
+					changed()
+				}
+			}()
+		}, myContractWindow)
+	})
+	btn_close := widget.NewButton("Close", func() {
+		myContractWindow.Close()
+	})
+
+	content := container.NewBorder(
+		container.NewBorder(nil, nil, nil, btn_add, container.NewGridWithColumns(2, name, scid)),
+		container.NewHBox(
+			btn_remove,
+			btn_deploy,
+			layout.NewSpacer(),
+			btn_close,
+		),
+		nil,
+		nil,
+		list,
+	)
+
+	myContractWindow.SetContent(content)
+	myContractWindow.Show()
+}
+
+// new window to manage channel subscriptions
+func ChannelWindow(app fyne.App) {
+
+	myChannelWindow := app.NewWindow("dShout - Channels")
+	myChannelWindow.Resize(fyne.NewSize(400, 300))
+	myChannelWindow.SetFixedSize(true)
+
+	selected := -1
+	channels := widget.NewList(
+		func() int { return len(SC_Config.Channels) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(CHANNEL_PREFIX + SC_Config.Channels[i])
+		},
+	)
+	channels.OnSelected = func(id widget.ListItemID) { selected = id }
+	channels.OnUnselected = func(id widget.ListItemID) { selected = -1 }
+
+	name := widget.NewEntry()
+	name.SetPlaceHolder("#channel")
+
+	btn_subscribe := widget.NewButton("Subscribe", func() {
+		if err := SubscribeChannel(name.Text); err != nil {
+			dialog.ShowError(err, myChannelWindow)
+			return
+		}
+		name.SetText("")
+		channels.Refresh()
+	})
+	btn_unsubscribe := widget.NewButton("Unsubscribe", func() {
+		if selected < 0 || selected >= len(SC_Config.Channels) {
+			return
+		}
+		if err := UnsubscribeChannel(SC_Config.Channels[selected]); err != nil {
+			dialog.ShowError(err, myChannelWindow)
+			return
+		}
+		channels.UnselectAll()
+		channels.Refresh()
+	})
+	btn_close := widget.NewButton("Close", func() {
+		myChannelWindow.Close()
+	})
+
+	content := container.NewBorder(
+		container.NewBorder(nil, nil, nil, btn_subscribe, name),
+		container.NewHBox(
+			btn_unsubscribe,
+			layout.NewSpacer(),
+			btn_close,
+		),
+		nil,
+		nil,
+		channels,
+	)
+
+	myChannelWindow.SetContent(content)
+	myChannelWindow.Show()
+}
+
+// new window to view sent messages and their delivery status
+func SentWindow(app fyne.App) {
+
+	mySentWindow := app.NewWindow("dShout - Sent")
+	mySentWindow.Resize(fyne.NewSize(600, 400))
+	mySentWindow.SetFixedSize(true)
+
+	message := widget.NewMultiLineEntry()
+	message.SetMinRowsVisible(6)
+	info := widget.NewEntry()
+
+	items := SentMessages()
+	sent := widget.NewList(
+		func() int { return len(items) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			s := items[len(items)-1-i]
+			o.(*widget.Label).SetText(fmt.Sprintf("%s  %-9s  %d receiver(s)  [%s]", s.Time, s.Status, len(s.Receivers), ContractName(s.SCID)))
+		},
+	)
+	sent.OnSelected = func(id widget.ListItemID) {
+		s := items[len(items)-1-id]
+		info.SetText(fmt.Sprintf("TXID: %s", s.TXID))
+		message.SetText(strings.Join(s.Receivers, "\n") + "\n\n" + s.Message)
+	}
+
+	btn_refresh := widget.NewButton("Refresh status", func() {
+		if err := SentUpdateStatus(); err != nil {
+			dialog.ShowError(err, mySentWindow)
+		}
+		items = SentMessages()
+		sent.UnselectAll()
+		sent.Refresh()
+	})
+	btn_close := widget.NewButton("Close", func() {
+		mySentWindow.Close()
+	})
+
+	content := container.NewBorder(
+		nil,
+		container.NewVBox(
+			info,
+			message,
+			container.NewHBox(
+				btn_refresh,
+				layout.NewSpacer(),
+				btn_close,
+			),
+		),
+		nil,
+		nil,
+		sent,
+	)
+
+	mySentWindow.SetContent(content)
+	mySentWindow.Show()
+}
+
+// new window to retry or cancel prepared envelopes
+func OutboxWindow(app fyne.App) {
+
+	myOutboxWindow := app.NewWindow("dShout - Outbox")
+	myOutboxWindow.Resize(fyne.NewSize(600, 400))
+	myOutboxWindow.SetFixedSize(true)
+
+	items := OutboxItems()
+	info := widget.NewMultiLineEntry()
+	info.SetMinRowsVisible(4)
+
+	selected := -1
+	list := widget.NewList(
+		func() int { return len(items) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			item := items[len(items)-1-i]
+			o.(*widget.Label).SetText(fmt.Sprintf("%s  %-9s  %d receiver(s)  [%s]", item.Created, item.State, len(item.Receivers), ContractName(item.SCID)))
+		},
+	)
+	list.OnSelected = func(id widget.ListItemID) {
+		selected = id
+		item := items[len(items)-1-id]
+		text := fmt.Sprintf("Attempts: %d", item.Attempts)
+		if item.State == OUTBOX_SCHEDULED {
+			text += fmt.Sprintf("\nScheduled for %s", item.Schedule)
+		}
+		if item.TXID != "" {
+			text += fmt.Sprintf("\nTXID: %s", item.TXID)
+		}
+		if item.Error != "" {
+			text += fmt.Sprintf("\nError: %s", item.Error)
+		}
+		info.SetText(text + "\n\n" + strings.Join(item.Receivers, "\n"))
+	}
+	list.OnUnselected = func(id widget.ListItemID) { selected = -1 }
+
+	update := func() {
+		items = OutboxItems()
+		list.UnselectAll()
+		list.Refresh()
+		info.SetText("")
+	}
+
+	// sends run in the background, the wallet may wait for the user
+	btn_retry := widget.NewButton("Retry", func() {
+		if selected < 0 || selected >= len(items) {
+			return
+		}
+		id := items[len(items)-1-selected].ID
+		go func() {
+			if _, err := OutboxSend(id); err != nil {
+				dialog.ShowError(err, myOutboxWindow)
+			}
+			update()
+		}()
+		update()
+	})
+	btn_cancel := widget.NewButton("Cancel entry", func() {
+		if selected < 0 || selected >= len(items) {
+			return
+		}
+		if err := OutboxCancel(items[len(items)-1-selected].ID); err != nil {
+			dialog.ShowError(err, myOutboxWindow)
+		}
+		update()
+	})
+	btn_batch := widget.NewButton("Send all (batched)", func() {
+		var ids []int64
+		for _, item := range items {
+			if item.State == OUTBOX_QUEUED || item.State == OUTBOX_FAILED {
+				ids = append(ids, item.ID)
+			}
+		}
+		if len(ids) == 0 {
+			return
+		}
+		go func() {
+			sent, err := OutboxSendBatch(ids)
+			if err != nil {
+				dialog.ShowError(err, myOutboxWindow)
+			} else {
+				dialog.ShowInformation("Outbox", fmt.Sprintf("%d envelope(s) sent in %d transaction(s)", len(ids), sent), myOutboxWindow)
+			}
+			update()
+		}()
+	})
+	btn_refresh := widget.NewButton("Refresh", func() {
+		go func() {
+			OutboxProcess()
+			update()
+		}()
+	})
+	btn_close := widget.NewButton("Close", func() {
+		myOutboxWindow.Close()
+	})
+
+	content := container.NewBorder(
+		nil,
+		container.NewVBox(
+			info,
+			container.NewHBox(
+				btn_retry,
+				btn_cancel,
+				btn_batch,
+				btn_refresh,
+				layout.NewSpacer(),
+				btn_close,
+			),
+		),
+		nil,
+		nil,
+		list,
+	)
+
+	myOutboxWindow.SetContent(content)
+	myOutboxWindow.Show()
+}
+
+// new window to manage contacts, names can be used as receivers
+func ContactWindow(app fyne.App) {
+
+	myContactWindow := app.NewWindow("dShout - Contacts")
+	myContactWindow.Resize(fyne.NewSize(600, 300))
+	myContactWindow.SetFixedSize(true)
+
+	var names []string
+	var contacts map[string]string
+	update := func() {
+		contacts = Contacts()
+		names = names[:0]
+		for n := range contacts {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+	}
+	update()
+
+	selected := -1
+	list := widget.NewList(
+		func() int { return len(names) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(fmt.Sprintf("%s  %s", names[i], contacts[names[i]]))
+		},
+	)
+	list.OnSelected = func(id widget.ListItemID) { selected = id }
+	list.OnUnselected = func(id widget.ListItemID) { selected = -1 }
+
+	name := widget.NewEntry()
+	name.SetPlaceHolder("Name")
+	address := widget.NewEntry()
+	address.SetPlaceHolder("Address or DERO name")
+
+	btn_add := widget.NewButton("Add", func() {
+		if err := AddContact(strings.TrimSpace(name.Text), strings.TrimSpace(address.Text)); err != nil {
+			dialog.ShowError(err, myContactWindow)
+			return
+		}
+		name.SetText("")
+		address.SetText("")
+		update()
+		list.Refresh()
+	})
+	btn_remove := widget.NewButton("Remove", func() {
+		if selected < 0 || selected >= len(names) {
+			return
+		}
+		if err := RemoveContact(names[selected]); err != nil {
+			dialog.ShowError(err, myContactWindow)
+		}
+		list.UnselectAll()
+		update()
+		list.Refresh()
+	})
+	btn_close := widget.NewButton("Close", func() {
+		myContactWindow.Close()
+	})
+
+	content := container.NewBorder(
+		container.NewBorder(nil, nil, nil, btn_add, container.NewGridWithColumns(2, name, address)),
+		container.NewHBox(
+			btn_remove,
+			layout.NewSpacer(),
+			btn_close,
+		),
+		nil,
+		nil,
+		list,
+	)
+
+	myContactWindow.SetContent(content)
+	myContactWindow.Show()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// known-good versions of the Store contract
+var known_codes = []string{
+	store_code,
+}
+
+// contracts with unknown code, sending is disabled while there are any.
+// Changed from the UI, read_only is also checked by the background loops
+var unverified = map[string]bool{}
+var unverified_mu sync.Mutex
+var read_only atomic.Bool
+
+// mark a contract as verified or not and update read-only mode
+func set_unverified(scid string, u bool) {
+
+	unverified_mu.Lock()
+	defer unverified_mu.Unlock()
+
+	if u {
+		unverified[scid] = true
+	} else {
+		delete(unverified, scid)
+	}
+	read_only.Store(len(unverified) > 0)
+}
+
+// strip comments and formatting, the deployed code may differ in whitespace.
+// String literals are kept as they are, they may contain "//" or several spaces
+func NormalizeCode(code string) string {
+
+	code = strings.ReplaceAll(code, "\r\n", "\n")
+
+	var b strings.Builder
+	space := false
+	for i := 0; i < len(code); i++ {
+		switch c := code[i]; {
+		case c == '"':
+			end := i + 1
+			for end < len(code) && code[end] != '"' && code[end] != '\n' {
+				if code[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(code))
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(code[i:end])
+			space = false
+			i = end - 1
+		case strings.HasPrefix(code[i:], "//"):
+			if n := strings.IndexByte(code[i:], '\n'); n >= 0 {
+				i += n - 1
+			} else {
+				i = len(code)
+			}
+		case strings.HasPrefix(code[i:], "/*"):
+			if n := strings.Index(code[i+2:], "*/"); n >= 0 {
+				i += n + 3
+			} else {
+				i = len(code)
+			}
+		case c == '\n':
+			b.WriteByte('\n')
+			space = false
+		case c == ' ' || c == '\t' || c == '\r':
+			space = true
+		default:
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteByte(c)
+			space = false
+		}
+	}
+
+	var lines []string
+	for _, l := range strings.Split(b.String(), "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			lines = append(lines, l)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func CodeHash(code string) string {
+	h := sha256.Sum256([]byte(NormalizeCode(code)))
+	return hex.EncodeToString(h[:])
+}
+
+// compare the code of a contract with the known versions
+func SC_VerifyCode(scid string) error {
+
+	var r GetSC_Result
+	if err := xswd.Call(DAEMON_GET_SC, GetSC_Params{SCID: scid, Code: true}, &r); err != nil {
+		return err
+	}
+	if r.Code == "" {
+		return fmt.Errorf("no code found")
+	}
+
+	hash := CodeHash(r.Code)
+	for _, k := range known_codes {
+		if CodeHash(k) == hash {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown contract code %s", hash[:16])
+}
+
+// check all configured contracts, unknown ones lock the app into read-only mode
+func SC_VerifyContracts() (warnings []string) {
+
+	for _, c := range SC_Config.Contracts {
+		if err := SC_VerifyContract(c); err != nil {
+			warnings = append(warnings, err.Error())
+		}
+	}
+
+	return
+}
+
+func SC_VerifyContract(c Contract) error {
+
+	if err := SC_VerifyCode(c.SCID); err != nil {
+		set_unverified(c.SCID, true)
+		log_xswd.Printf("Contract %s (%s) can't be verified: %s", c.Name, c.SCID, err)
+		return fmt.Errorf("%s: %s", c.Name, err)
+	}
+	set_unverified(c.SCID, false)
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeCode(t *testing.T) {
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"whitespace", "Function  Store(msg String) Uint64\r\n\t10   RETURN 0\n\n", "Function Store(msg String) Uint64\n10 RETURN 0"},
+		{"line comment", "10 RETURN 0 // done\n", "10 RETURN 0"},
+		{"block comment", "/* header\n spanning lines */\n10 RETURN 0", "10 RETURN 0"},
+		{"slashes in string", `10 STORE("url", "https://example.com") // comment`, `10 STORE("url", "https://example.com")`},
+		{"comment start in string", `10 STORE("a", "/* not a comment */")`, `10 STORE("a", "/* not a comment */")`},
+		{"spaces in string", `10 STORE("a",  "two  spaces")`, `10 STORE("a", "two  spaces")`},
+		{"escaped quote", `10 STORE("a", "say \"//\"") // comment`, `10 STORE("a", "say \"//\"")`},
+	}
+	for _, tt := range tests {
+		if got := NormalizeCode(tt.in); got != tt.want {
+			t.Errorf("%s: NormalizeCode = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCodeHash(t *testing.T) {
+
+	reformatted := "// redeployed copy\n" + strings.ReplaceAll(store_code, "\n", "\n\n  ")
+	if CodeHash(reformatted) != CodeHash(store_code) {
+		t.Error("formatting changes the code hash")
+	}
+
+	// a changed string literal is a different contract
+	changed := strings.Replace(store_code, `"msg"`, `"msg "`, 1)
+	if changed == store_code {
+		t.Fatal("store code has no \"msg\" literal")
+	}
+	if CodeHash(changed) == CodeHash(store_code) {
+		t.Error("changed string literal has the same hash")
+	}
+}
+
+func TestReadOnlyTransfer(t *testing.T) {
+
+	defer read_only.Store(read_only.Load())
+	read_only.Store(true)
+
+	if _, err := SC_Transfer(Transfer_Params{}); err == nil {
+		t.Error("transfer allowed in read-only mode")
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// The Store contract saves BLOCK_HEIGHT() values, but DERO.GetSC and DERO.GetBlock
+// expect topoheights. On the DAG several blocks can share one height, so a height
+// is mapped to the last topoheight of that height: its snapshot contains all Store
+// calls of the height. The daemon rejects blocks whose tips aren't all at the height
+// below, so heights never decrease along the topological order; the search in
+// Resolve relies on that.
+
+// block header lookup by topoheight
+type HeaderSource func(topo int64) (BlockHeader_Print, error)
+
+type Walker struct {
+	Header  HeaderSource
+	TopoTip int64
+	Tip     func() (int64, error)
+	Probes  int // parallel header requests per search step
+	cache   map[int64]BlockHeader_Print
+	stable  int64 // stable height of the last Prune
+	mu      sync.Mutex
+}
+
+var walker *Walker
+
+func NewWalker(header HeaderSource, tip func() (int64, error)) (*Walker, error) {
+
+	w := &Walker{
+		Header: header,
+		Tip:    tip,
+		Probes: 1,
+		cache:  map[int64]BlockHeader_Print{},
+	}
+	if err := w.Refresh(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// walker using the daemon
+func CurrentWalker() (*Walker, error) {
+
+	if walker != nil {
+		return walker, nil
+	}
+
+	w, err := NewWalker(GetBlockHeaderByTopo, func() (int64, error) {
+		r, err := GetHeight()
+		return r.TopoHeight, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	w.Probes = SC_Config.Workers
+	walker = w
+
+	return walker, nil
+}
+
+func (w *Walker) Refresh() error {
+
+	tip, err := w.Tip()
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.TopoTip = tip
+	w.mu.Unlock()
+
+	return nil
+}
+
+// forget cached headers that may have changed, headers fetched since the
+// last call were unstable if their height wasn't below the stable height of then
+func (w *Walker) Prune(stable int64) {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for t, b := range w.cache {
+		if b.Height >= min(w.stable, stable) {
+			delete(w.cache, t)
+		}
+	}
+	w.stable = stable
+}
+
+func (w *Walker) header(topo int64) (BlockHeader_Print, error) {
+
+	w.mu.Lock()
+	h, ok := w.cache[topo]
+	w.mu.Unlock()
+	if ok {
+		return h, nil
+	}
+
+	h, err := w.Header(topo)
+	if err != nil {
+		return h, err
+	}
+	w.mu.Lock()
+	w.cache[topo] = h
+	w.mu.Unlock()
+
+	return h, nil
+}
+
+// fetch several headers in parallel
+func (w *Walker) headers(topos []int64) ([]BlockHeader_Print, error) {
+
+	if len(topos) == 1 {
+		b, err := w.header(topos[0])
+		return []BlockHeader_Print{b}, err
+	}
+
+	blocks := make([]BlockHeader_Print, len(topos))
+	errs := make([]error, len(topos))
+
+	var wg sync.WaitGroup
+	for i, t := range topos {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			blocks[i], errs[i] = w.header(t)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return blocks, nil
+}
+
+// last topoheight with the given height
+func (w *Walker) Resolve(height uint64) (int64, error) {
+
+	h := int64(height)
+
+	// there is at least one block per height, so topoheight >= height
+	w.mu.Lock()
+	lo, hi := h, w.TopoTip
+	w.mu.Unlock()
+	if lo > hi {
+		if err := w.Refresh(); err != nil {
+			return 0, err
+		}
+		w.mu.Lock()
+		hi = w.TopoTip
+		w.mu.Unlock()
+		if lo > hi {
+			return 0, fmt.Errorf("height %d not reached yet", height)
+		}
+	}
+
+	// narrow the range with known headers
+	w.mu.Lock()
+	for t, b := range w.cache {
+		if b.Height <= h && t > lo && t <= hi {
+			lo = t
+		} else if b.Height > h && t <= hi && t > lo {
+			hi = t - 1
+		}
+	}
+	w.mu.Unlock()
+
+	// search the last topoheight whose height is <= the wanted height,
+	// with several probes the range is split in Probes+1 parts per step
+	for lo < hi {
+		k := int64(max(w.Probes, 1))
+		if k > hi-lo {
+			k = hi - lo
+		}
+		probes := make([]int64, k)
+		for i := range probes {
+			probes[i] = lo + (hi-lo)*int64(i+1)/(k+1) + 1
+		}
+
+		blocks, err := w.headers(probes)
+		if err != nil {
+			return 0, err
+		}
+
+		new_lo, new_hi := lo, hi
+		for i, t := range probes {
+			if blocks[i].Height <= h {
+				new_lo = max(new_lo, t)
+			} else {
+				new_hi = min(new_hi, t-1)
+			}
+		}
+		lo, hi = new_lo, new_hi
+	}
+
+	b, err := w.header(lo)
+	if err != nil {
+		return 0, err
+	}
+	if b.Height != h {
+		return 0, fmt.Errorf("no block at height %d", height)
+	}
+
+	return lo, nil
+}
+
+// header of the last block at the given height
+func (w *Walker) HeaderAt(height uint64) (BlockHeader_Print, error) {
+
+	topo, err := w.Resolve(height)
+	if err != nil {
+		return BlockHeader_Print{}, err
+	}
+
+	return w.header(topo)
+}
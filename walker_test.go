@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+)
+
+// fake DAG, blocks by topoheight
+type test_chain []BlockHeader_Print
+
+func new_test_chain(heights ...int64) *test_chain {
+
+	c := &test_chain{}
+	for _, h := range heights {
+		c.add(h, "")
+	}
+
+	return c
+}
+
+func (c *test_chain) add(height int64, fork string) {
+
+	topo := int64(len(*c))
+	*c = append(*c, BlockHeader_Print{
+		Hash:       fmt.Sprintf("%s%d/%d", fork, topo, height),
+		Height:     height,
+		TopoHeight: topo,
+	})
+}
+
+// replace the blocks from topo on
+func (c *test_chain) fork(topo int64, fork string, heights ...int64) {
+
+	*c = (*c)[:topo]
+	for _, h := range heights {
+		c.add(h, fork)
+	}
+}
+
+// walker on the fake chain, it also serves GetBlockHeader
+func test_walker(t *testing.T, c *test_chain) *Walker {
+
+	t.Helper()
+
+	w, err := NewWalker(func(topo int64) (BlockHeader_Print, error) {
+		if topo < 0 || topo >= int64(len(*c)) {
+			return BlockHeader_Print{}, fmt.Errorf("topoheight %d not found", topo)
+		}
+		return (*c)[topo], nil
+	}, func() (int64, error) {
+		return int64(len(*c)) - 1, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := walker
+	walker = w
+	t.Cleanup(func() { walker = old })
+
+	return w
+}
+
+// last topoheight of a height by a linear scan
+func (c *test_chain) last(height int64) int64 {
+
+	topo := int64(-1)
+	for _, b := range *c {
+		if b.Height == height {
+			topo = b.TopoHeight
+		}
+	}
+
+	return topo
+}
+
+func test_resolve_all(t *testing.T, w *Walker, c *test_chain) {
+
+	t.Helper()
+
+	top := (*c)[len(*c)-1].Height
+	for h := int64(0); h <= top; h++ {
+		topo, err := w.Resolve(uint64(h))
+		if err != nil {
+			t.Fatalf("Resolve(%d): %v", h, err)
+		}
+		if want := c.last(h); topo != want {
+			t.Fatalf("Resolve(%d) = %d, want %d", h, topo, want)
+		}
+	}
+}
+
+func TestWalkerSideBlocks(t *testing.T) {
+
+	// several blocks share the heights 2, 4 and 5
+	c := new_test_chain(0, 1, 2, 2, 2, 3, 4, 4, 5, 5, 6)
+
+	for _, probes := range []int{1, 2, 4} {
+		w := test_walker(t, c)
+		w.Probes = probes
+		test_resolve_all(t, w, c)
+
+		b, err := w.HeaderAt(4)
+		if err != nil || b.TopoHeight != 7 {
+			t.Errorf("HeaderAt(4) = %+v, %v", b, err)
+		}
+	}
+}
+
+func TestWalkerRandomChains(t *testing.T) {
+
+	// heights never decrease along the topological order, the search relies on it
+	for n := range 50 {
+		var heights []int64
+		h := int64(0)
+		for range 1 + rand.IntN(200) {
+			heights = append(heights, h)
+			if rand.IntN(3) > 0 {
+				h++
+			}
+		}
+		c := new_test_chain(heights...)
+		w := test_walker(t, c)
+		w.Probes = 1 + n%5
+		test_resolve_all(t, w, c)
+	}
+}
+
+func TestWalkerCache(t *testing.T) {
+
+	c := new_test_chain(0, 1, 2, 3, 3, 4, 5, 6, 7, 8, 9)
+	w := test_walker(t, c)
+
+	calls := 0
+	source := w.Header
+	w.Header = func(topo int64) (BlockHeader_Print, error) {
+		calls++
+		return source(topo)
+	}
+
+	if _, err := w.Resolve(3); err != nil {
+		t.Fatal(err)
+	}
+	first := calls
+	if _, err := w.Resolve(3); err != nil {
+		t.Fatal(err)
+	}
+	if calls != first {
+		t.Errorf("cached height fetched %d headers again", calls-first)
+	}
+}
+
+func TestWalkerTip(t *testing.T) {
+
+	c := new_test_chain(0, 1, 2, 3)
+	w := test_walker(t, c)
+
+	if _, err := w.Resolve(5); err == nil {
+		t.Fatal("resolved a height above the tip")
+	}
+
+	// the tip is refreshed when a height above it is requested
+	c.add(4, "")
+	c.add(5, "")
+	if topo, err := w.Resolve(5); err != nil || topo != 5 {
+		t.Errorf("Resolve(5) = %d, %v", topo, err)
+	}
+}
+
+func TestWalkerReorg(t *testing.T) {
+
+	c := new_test_chain(0, 1, 2, 3, 4, 5, 5, 6, 7)
+	w := test_walker(t, c)
+	w.Prune(4)
+	test_resolve_all(t, w, c)
+
+	// the unstable part is replaced by a fork with other side blocks
+	c.fork(5, "fork", 5, 6, 6, 6, 7, 8)
+	w.Refresh()
+	w.Prune(5)
+	test_resolve_all(t, w, c)
+
+	b, err := w.HeaderAt(6)
+	if err != nil || b.Hash != fmt.Sprintf("fork%d/6", 8) {
+		t.Errorf("HeaderAt(6) = %+v, %v", b, err)
+	}
+
+	// stable headers stay cached
+	if _, ok := w.cache[3]; !ok {
+		t.Error("stable header pruned")
+	}
+}
@@ -4,20 +4,43 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 type XSWD struct {
-	connection *websocket.Conn
-	active     bool
+	connection *websocket.Conn // replaced on reconnect while holding write_mu and mu
+	active     atomic.Bool
 	address    url.URL
 	AppInfo    *AppicationInfo
-	response   chan []byte
+	pending    map[string]chan []byte
+	next_id    atomic.Uint64
+	mu         sync.Mutex
+	write_mu   sync.Mutex
+	connected  atomic.Bool
+
+	on_reconnect func()
 }
 
+// wallet calls may wait for the user to accept them
+const XSWD_TIMEOUT = 5 * time.Minute
+const XSWD_RECONNECT = 10 * time.Second
+
+// the request wasn't written, the wallet never saw it
+var ErrNotSent = errors.New("error sending request")
+
+// the request was written but no response arrived, the wallet may have executed it
+var ErrConnectionLost = errors.New("connection lost")
+var ErrNoResponse = errors.New("no response")
+
 type XSWD_Auth_Response struct {
 	Accepted bool   `json:"accepted"`
 	Message  string `json:"message"`
@@ -42,7 +65,7 @@ func XSWD_Init() *XSWD {
 			Host:   "localhost:44326",
 			Path:   "/xswd",
 		},
-		response: make(chan []byte),
+		pending: map[string]chan []byte{},
 	}
 
 	return &xswd
@@ -55,28 +78,96 @@ func (x *XSWD) XSWD_SetServer(server string) {
 }
 
 func (x *XSWD) XSWD_Connect() error {
+
+	if err := x.xswd_dial(); err != nil {
+		return err
+	}
+	go x.xswd_read_loop()
+
+	return nil
+}
+
+// called in a new goroutine after every reconnect
+func (x *XSWD) SetOnReconnect(f func()) {
+	x.mu.Lock()
+	x.on_reconnect = f
+	x.mu.Unlock()
+}
+
+func (x *XSWD) Connected() bool {
+	return x.connected.Load()
+}
+
+func (x *XSWD) xswd_dial() error {
 	log_xswd.Println("> Connect")
-	if c, _, err := websocket.DefaultDialer.Dial(x.address.String(), nil); err != nil {
+	c, _, err := websocket.DefaultDialer.Dial(x.address.String(), nil)
+	if err != nil {
 		return err
-	} else {
-		x.connection = c
 	}
 
-	if err := x.xswd_authorize(); err != nil {
+	if err := x.xswd_authorize(c); err != nil {
+		c.Close()
 		return err
 	}
-	go x.xswd_read_loop()
+
+	// calls of other goroutines may be writing to the old connection
+	x.write_mu.Lock()
+	x.mu.Lock()
+	x.connection = c
+	x.mu.Unlock()
+	x.write_mu.Unlock()
+	x.connected.Store(true)
 
 	return nil
 }
 
+func (x *XSWD) conn() *websocket.Conn {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.connection
+}
+
+// connection lost, fail running calls and connect again
+func (x *XSWD) xswd_reconnect() {
+
+	x.connected.Store(false)
+	x.conn().Close()
+	log_xswd.Println("> Connection lost")
+
+	x.mu.Lock()
+	for _, ch := range x.pending {
+		select {
+		case ch <- nil:
+		default:
+		}
+	}
+	x.mu.Unlock()
+
+	for x.active.Load() {
+		time.Sleep(XSWD_RECONNECT)
+		if err := x.xswd_dial(); err != nil {
+			log_xswd.Println(err)
+			continue
+		}
+		x.mu.Lock()
+		f := x.on_reconnect
+		x.mu.Unlock()
+		if f != nil {
+			go f()
+		}
+		return
+	}
+}
+
 func (x *XSWD) XSWD_Exit() {
-	x.active = false
-	x.connection.Close()
+	x.active.Store(false)
+	if c := x.conn(); c != nil {
+		c.Close()
+	}
 	log_xswd.Println("> Shutdown")
 }
 
-func (x *XSWD) xswd_authorize() error {
+func (x *XSWD) xswd_authorize(c *websocket.Conn) error {
 
 	log_xswd.Println("> Authorization")
 
@@ -88,11 +179,11 @@ func (x *XSWD) xswd_authorize() error {
 		return err
 	}
 
-	if err = x.connection.WriteMessage(websocket.TextMessage, data); err != nil {
+	if err = c.WriteMessage(websocket.TextMessage, data); err != nil {
 		return err
 	}
 
-	_, buffer, err := x.connection.ReadMessage()
+	_, buffer, err := c.ReadMessage()
 	if err != nil {
 		return err
 	}
@@ -104,7 +195,7 @@ func (x *XSWD) xswd_authorize() error {
 	if !auth_response.Accepted {
 		return fmt.Errorf("authorization failed")
 	}
-	x.active = true
+	x.active.Store(true)
 
 	log_xswd.Println(auth_response.Message)
 
@@ -113,25 +204,84 @@ func (x *XSWD) xswd_authorize() error {
 
 func (x *XSWD) xswd_read_loop() {
 
-	for x.active {
-		msg_type, buffer, err := x.connection.ReadMessage()
+	for x.active.Load() {
+		msg_type, buffer, err := x.conn().ReadMessage()
 		if err != nil {
+			if x.active.Load() {
+				x.xswd_reconnect()
+			}
 			continue
 		}
 		if msg_type != websocket.TextMessage {
 			continue
 		}
-		x.response <- buffer
+
+		// responses are matched to their requests by ID
+		var temp struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if err = json.Unmarshal(buffer, &temp); err != nil {
+			continue
+		}
+		id := strings.Trim(string(temp.ID), `"`)
+
+		x.mu.Lock()
+		ch, ok := x.pending[id]
+		x.mu.Unlock()
+		if ok {
+			ch <- buffer
+		}
 	}
 }
 
 func (x *XSWD) xswd_send(data []byte) bool {
+	x.write_mu.Lock()
+	defer x.write_mu.Unlock()
+
 	if err := x.connection.WriteMessage(websocket.TextMessage, data); err != nil {
 		return false
 	}
 	return true
 }
 
+// send a request and wait for its response, all calls share the rate limiter
+func (x *XSWD) Call(method string, params any, result any) error {
+
+	rateLimit.Wait()
+
+	req := RPC_Request(method, params)
+	req.ID = strconv.FormatUint(x.next_id.Add(1), 10)
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	ch := make(chan []byte, 1)
+	x.mu.Lock()
+	x.pending[req.ID] = ch
+	x.mu.Unlock()
+
+	defer func() {
+		x.mu.Lock()
+		delete(x.pending, req.ID)
+		x.mu.Unlock()
+	}()
+
+	if !x.Connected() || !x.xswd_send(data) {
+		return ErrNotSent
+	}
+
+	select {
+	case b := <-ch:
+		if b == nil {
+			return fmt.Errorf("%s: %w", method, ErrConnectionLost)
+		}
+		return xswd_response(b, result)
+	case <-time.After(XSWD_TIMEOUT):
+		return fmt.Errorf("%s: %w", method, ErrNoResponse)
+	}
+}
+
 func xswd_response(b []byte, t any) error {
 
 	var temp JSONRPCResponse